@@ -3,9 +3,20 @@ package agent
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/jobs/allin"
+	"github.com/elissonalvesilva/releasy/internal/jobs/canary"
+	"github.com/elissonalvesilva/releasy/internal/jobs/configure"
+	"github.com/elissonalvesilva/releasy/internal/jobs/gate"
+	"github.com/elissonalvesilva/releasy/internal/jobs/guard"
 	"github.com/elissonalvesilva/releasy/internal/jobs/initial"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/rolling"
+	"github.com/elissonalvesilva/releasy/internal/jobs/teardown"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
@@ -18,90 +29,625 @@ import (
 	"github.com/go-redis/redis/v8"
 )
 
+const (
+	DefaultClaimMinIdle    = 5 * time.Minute
+	DefaultReclaimInterval = 30 * time.Second
+	DefaultMaxDeliveries   = 5
+	DefaultWorkers         = 4
+
+	reclaimBatch = 10
+	lockTTL      = 30 * time.Second
+	lockRetry    = 2 * time.Second
+
+	// recoverLockWait bounds how long a resumed deployment waits for the lock of its
+	// service, which another deployment may have taken while this agent was down.
+	recoverLockWait = 10 * time.Minute
+)
+
+// errUnknownStrategy rejects a job no handler of this agent can run.
+var errUnknownStrategy = errors.New("unknown strategy")
+
+// inFlightJob is what the control channel acts on while a job runs.
+type inFlightJob struct {
+	cancel context.CancelCauseFunc
+	gate   *gate.Gate
+}
+
+// heldJob is a job claimed by this agent that does not run yet, as no worker was free
+// or another deployment of its service held the lock. It is tried again from notBefore.
+type heldJob struct {
+	job       store.PendingJob
+	notBefore time.Time
+}
+
 type Agent struct {
 	AgentName     string
-	StreamName    string
+	StreamNames   []string
 	GroupName     string
 	DockerClient  docker.DockerClient
 	HealthChecker healthcheck.HealthChecker
 	TraefikClient traefik.TraefikInterface
 	Stream        store.Streams
+	Locker        store.Locker
 	db            store.DbStore
+	progress      *progress.Reporter
+
+	// inFlight holds every job this agent is running, by deployment, and held the
+	// jobs it claimed without running them yet.
+	mu       sync.Mutex
+	inFlight map[string]*inFlightJob
+	held     []heldJob
+
+	// ClaimMinIdle is how long a job stays pending before another attempt takes it over.
+	ClaimMinIdle    time.Duration
+	ReclaimInterval time.Duration
+	// MaxDeliveries is the number of attempts after which a job is dead-lettered.
+	MaxDeliveries int64
+	// Workers is the number of jobs run at the same time, for different services.
+	Workers int
 
 	blueGreenJob *bluegreen.Handler
 	initialJob   *initial.Handler
+	rollingJob   *rolling.Handler
+	canaryJob    *canary.Handler
+	allInJob     *allin.Handler
+	teardownJob  *teardown.Handler
+	configureJob *configure.Handler
 }
 
 func NewAgent(
-	agentName, streamName, groupName string,
+	agentName string,
+	streamNames []string,
+	groupName string,
 	dockerClient docker.DockerClient,
 	healthChecker healthcheck.HealthChecker,
 	traefikClient traefik.TraefikInterface,
+	metrics traefik.MetricsReader,
 	stream store.Streams,
+	locker store.Locker,
 	db store.DbStore,
 ) *Agent {
+	candidateGuard := guard.New(healthChecker, metrics)
+	reporter := progress.New(db, stream)
+
 	return &Agent{
-		AgentName:     agentName,
-		StreamName:    streamName,
-		GroupName:     groupName,
-		DockerClient:  dockerClient,
-		HealthChecker: healthChecker,
-		TraefikClient: traefikClient,
-		Stream:        stream,
-		db:            db,
+		AgentName:       agentName,
+		StreamNames:     streamNames,
+		GroupName:       groupName,
+		ClaimMinIdle:    DefaultClaimMinIdle,
+		ReclaimInterval: DefaultReclaimInterval,
+		MaxDeliveries:   DefaultMaxDeliveries,
+		Workers:         DefaultWorkers,
+		DockerClient:    dockerClient,
+		HealthChecker:   healthChecker,
+		TraefikClient:   traefikClient,
+		Stream:          stream,
+		Locker:          locker,
+		db:              db,
+		progress:        reporter,
+		inFlight:        map[string]*inFlightJob{},
 
-		blueGreenJob: bluegreen.New(dockerClient, traefikClient, healthChecker, db),
-		initialJob:   initial.NewAgent(dockerClient, traefikClient, healthChecker, db),
+		blueGreenJob: bluegreen.New(dockerClient, traefikClient, healthChecker, candidateGuard, db, reporter),
+		initialJob:   initial.NewAgent(dockerClient, traefikClient, healthChecker, db, reporter),
+		rollingJob:   rolling.New(dockerClient, traefikClient, healthChecker, db, reporter),
+		canaryJob:    canary.New(dockerClient, traefikClient, healthChecker, candidateGuard, db, reporter),
+		allInJob:     allin.New(dockerClient, traefikClient, healthChecker, db, reporter),
+		teardownJob:  teardown.New(dockerClient, traefikClient, db, reporter),
+		configureJob: configure.New(traefikClient, db, reporter),
 	}
 }
 
-func (a *Agent) Start() {
+func (a *Agent) Start() error {
 	ctx := context.Background()
-	logger.Info(fmt.Sprintf("[Agent] %s started - watching stream: %s", a.AgentName, a.StreamName))
 
+	for _, stream := range a.StreamNames {
+		if err := a.Stream.EnsureGroup(stream, a.GroupName); err != nil {
+			return fmt.Errorf("ensure group %s on %s: %w", a.GroupName, stream, err)
+		}
+	}
+	logger.Info(fmt.Sprintf("[Agent] %s started - watching streams: %s", a.AgentName, strings.Join(a.StreamNames, ", ")))
+
+	workers := make(chan struct{}, max(a.Workers, 1))
+
+	go a.listenControl(ctx)
+	go a.Recover(ctx, workers)
+	go a.keepHeldClaimed()
+
+	lastReclaim := time.Now()
 	for {
-		messages, err := a.Stream.ReadJob(a.StreamName, a.GroupName, a.AgentName, 5*time.Second)
+		if time.Since(lastReclaim) >= a.ReclaimInterval {
+			a.reclaim()
+			lastReclaim = time.Now()
+		}
+
+		// A job is only taken once a worker is free to run it.
+		workers <- struct{}{}
+		if job, ok := a.nextHeld(); ok {
+			go a.work(ctx, job, workers)
+			continue
+		}
+
+		streams, err := a.Stream.ReadJobs(a.StreamNames, a.GroupName, a.AgentName, lockRetry)
 		if err != nil {
-			logger.WithError(err).Error("Error reading job")
-			time.Sleep(2 * time.Second)
+			<-workers
+			if !errors.Is(err, redis.Nil) {
+				logger.WithError(err).Error("Error reading job")
+				time.Sleep(2 * time.Second)
+			}
 			continue
 		}
 
-		if len(messages) == 0 {
+		var read []store.PendingJob
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				read = append(read, store.PendingJob{Stream: stream.Stream, Message: msg, Deliveries: 1})
+			}
+		}
+		if len(read) == 0 {
+			<-workers
 			continue
 		}
 
-		for _, msg := range messages {
-			deploy, err := parseMessage(msg)
-			if err != nil {
-				logger.Error(fmt.Sprintf("[Agent] Failed to parse job: %v", err))
+		// One entry is read per stream, the others wait for the next free worker.
+		a.hold(0, read[1:]...)
+		go a.work(ctx, read[0], workers)
+	}
+}
+
+// work runs a job on the worker it was given and holds it back for a while when its
+// service is locked, freeing the worker for the jobs of other services.
+func (a *Agent) work(ctx context.Context, job store.PendingJob, workers <-chan struct{}) {
+	defer func() { <-workers }()
+
+	if !a.process(ctx, job) {
+		a.hold(lockRetry, job)
+	}
+}
+
+// hold keeps jobs claimed by this agent aside until delay has passed.
+func (a *Agent) hold(delay time.Duration, jobs ...store.PendingJob) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, job := range jobs {
+		a.held = append(a.held, heldJob{job: job, notBefore: time.Now().Add(delay)})
+	}
+}
+
+// nextHeld takes the first held job that may be tried again.
+func (a *Agent) nextHeld() (store.PendingJob, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for i, h := range a.held {
+		if !h.notBefore.After(now) {
+			a.held = append(a.held[:i], a.held[i+1:]...)
+			return h.job, true
+		}
+	}
+	return store.PendingJob{}, false
+}
+
+// keepHeldClaimed keeps resetting the idle time of the held jobs, so that they are not
+// taken over by another agent while they wait here.
+func (a *Agent) keepHeldClaimed() {
+	ticker := time.NewTicker(max(a.ClaimMinIdle/3, time.Second))
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.mu.Lock()
+		held := make([]store.PendingJob, 0, len(a.held))
+		for _, h := range a.held {
+			held = append(held, h.job)
+		}
+		a.mu.Unlock()
+
+		for _, job := range held {
+			if err := a.Stream.TouchJob(job.Stream, a.GroupName, a.AgentName, job.Message.ID); err != nil {
+				logger.WithError(err).Warn(fmt.Sprintf("[Agent] Failed to keep job entry %s claimed", job.Message.ID))
+			}
+		}
+	}
+}
+
+// reclaim takes over the jobs left pending by a failed attempt or by an agent that
+// went away, and gives up on the ones that were delivered too many times.
+func (a *Agent) reclaim() {
+	for _, stream := range a.StreamNames {
+		pending, err := a.Stream.ReclaimJobs(stream, a.GroupName, a.AgentName, a.ClaimMinIdle, reclaimBatch)
+		if err != nil {
+			logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to reclaim pending jobs of %s", stream))
+			continue
+		}
+
+		for _, job := range pending {
+			logger.Info(fmt.Sprintf("[Agent] Reclaimed job entry %s of %s (delivery %d)", job.Message.ID, stream, job.Deliveries))
+			if job.Deliveries > a.MaxDeliveries {
+				a.giveUp(job)
 				continue
 			}
+			a.hold(0, job)
+		}
+	}
+}
+
+// giveUp parks a job that was delivered too many times, after marking its deployment
+// as failed so that its service is not seen busy with it forever. A job whose
+// deployment ended meanwhile is only acknowledged.
+func (a *Agent) giveUp(job store.PendingJob) {
+	deploy, err := parseMessage(job.Message)
+	if err != nil {
+		a.deadLetter(job, fmt.Sprintf("invalid job: %v", err))
+		return
+	}
+
+	ctx := context.Background()
+	recorded, err := a.db.GetDeploymentByID(ctx, deploy.ID)
+	switch {
+	case err == nil && domain.IsTerminalStep(recorded.Step):
+		a.ack(job, deploy)
+		return
+	case err == nil:
+		deploy.Step = recorded.Step
+		a.markFailed(ctx, deploy)
+	case !errors.Is(err, store.ErrNotFound):
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to load job %s, leaving it pending", deploy.ID))
+		return
+	}
+
+	a.deadLetter(job, fmt.Sprintf("delivered %d times", job.Deliveries))
+}
+
+// process runs a job, and reports false when it could not start because another
+// deployment of its service holds the lock, leaving it to be tried again. A job still
+// waiting for its lock is cancelled by marking its deployment as cancelled.
+func (a *Agent) process(ctx context.Context, job store.PendingJob) bool {
+	msg := job.Message
 
-			logger.Info(fmt.Sprintf("[Agent] JobID=%s Strategy=%s Service=%s Action=%s", deploy.ID, deploy.DeploymentStrategy, deploy.ServiceName, deploy.Action))
+	deploy, err := parseMessage(msg)
+	if err != nil {
+		logger.Error(fmt.Sprintf("[Agent] Failed to parse job: %v", err))
+		a.deadLetter(job, fmt.Sprintf("invalid job: %v", err))
+		return true
+	}
+
+	// Every delivery locks for itself, so a job delivered twice does not run twice.
+	owner := fmt.Sprintf("%s:%s:%d", a.AgentName, msg.ID, job.Deliveries)
+	unlock, ok, err := a.tryLockService(deploy, owner)
+	if err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to lock %s/%s for job %s, holding it", deploy.Application, deploy.ServiceName, deploy.ID))
+		return false
+	}
+	if !ok {
+		return false
+	}
+	defer unlock()
+
+	logger.Info(fmt.Sprintf("[Agent] JobID=%s Strategy=%s Service=%s Action=%s", deploy.ID, deploy.DeploymentStrategy, deploy.ServiceName, deploy.Action))
+
+	stopTouch := a.keepClaimed(job)
+	defer stopTouch()
+
+	ctx, untrack := a.track(ctx, deploy)
+	defer untrack()
+
+	// A job delivered again may already have been carried through, or only partially.
+	recorded, err := a.db.GetDeploymentByID(ctx, deploy.ID)
+	switch {
+	case err == nil && domain.IsTerminalStep(recorded.Step):
+		logger.Info(fmt.Sprintf("[Agent] Job %s is already %s, skipping", deploy.ID, recorded.Step))
+		a.ack(job, deploy)
+		return true
+	case err == nil:
+		deploy.Step = recorded.Step
+	case !errors.Is(err, store.ErrNotFound):
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to load job %s, leaving it pending", deploy.ID))
+		return true
+	}
+
+	payload, _ := msg.Values["payload"].(string)
+	if err := a.db.ClaimDeployment(ctx, deploy.ID, a.AgentName, payload); err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Agent] Failed to claim job %s", deploy.ID))
+	}
 
-			var procErr error
-			switch deploy.DeploymentStrategy {
-			case domain.StrategyBlueGreen:
-				procErr = a.blueGreenJob.Run(ctx, deploy)
-			case domain.StrategyInitialize:
-				procErr = a.initialJob.Run(ctx, deploy)
-			default:
-				logger.Info(fmt.Sprintf("[Agent] Unknown strategy: %s", deploy.DeploymentStrategy))
+	// Only the jobs that cannot run are dead-lettered. A deployment that failed or
+	// rolled back recorded it, and running it again is what a new deployment is for.
+	procErr := a.execute(ctx, deploy)
+	switch {
+	case procErr == nil:
+	case progress.Cancelled(ctx):
+		logger.Info(fmt.Sprintf("[Agent] Job %s was cancelled", deploy.ID))
+		a.markFailed(ctx, deploy)
+	case errors.Is(procErr, errUnknownStrategy):
+		a.markFailed(ctx, deploy)
+		a.deadLetter(job, procErr.Error())
+		return true
+	case domain.IsTerminalStep(deploy.Step):
+		logger.Info(fmt.Sprintf("[Agent] Job %s ended %s", deploy.ID, deploy.Step))
+	case job.Deliveries < a.MaxDeliveries:
+		// Left pending, the job is reclaimed once it was idle for ClaimMinIdle and
+		// resumed from the step it recorded.
+		logger.Warn(fmt.Sprintf("[Agent] Job %s failed on delivery %d of %d, it will be retried", deploy.ID, job.Deliveries, a.MaxDeliveries))
+		return true
+	default:
+		// Out of deliveries, running the deployment again needs a requeue.
+		a.markFailed(ctx, deploy)
+		a.deadLetter(job, procErr.Error())
+		return true
+	}
+
+	a.ack(job, deploy)
+	return true
+}
+
+// Recover picks up the deployments this agent left unfinished when it stopped, from
+// the step each one had recorded. Each one runs on a worker taken from workers, next to
+// the jobs read from the streams.
+func (a *Agent) Recover(ctx context.Context, workers chan struct{}) {
+	deployments, err := a.db.ListOwnedDeployments(ctx, a.AgentName, domain.TerminalSteps)
+	if err != nil {
+		logger.WithError(err).Error("[Agent] Failed to list unfinished deployments")
+		return
+	}
+
+	for _, recorded := range deployments {
+		var deploy dto.Deployment
+		if err := json.Unmarshal([]byte(recorded.Payload), &deploy); err != nil || deploy.ID == "" {
+			logger.Warn(fmt.Sprintf("[Agent] Deployment %s has no job to resume from", recorded.ID))
+			continue
+		}
+		deploy.Step = recorded.Step
+		go a.recover(ctx, &deploy, workers)
+	}
+}
+
+// recover resumes a deployment once a worker is free and the lock of its service is
+// taken. The worker is given back while another deployment holds the lock, and the
+// deployment is left for a later start of the agent after recoverLockWait.
+func (a *Agent) recover(ctx context.Context, deploy *dto.Deployment, workers chan struct{}) {
+	owner := fmt.Sprintf("%s:recover:%s", a.AgentName, deploy.ID)
+	deadline := time.Now().Add(recoverLockWait)
+	for {
+		workers <- struct{}{}
+		unlock, ok, err := a.tryLockService(deploy, owner)
+		if err != nil {
+			<-workers
+			logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to lock %s/%s to resume %s", deploy.Application, deploy.ServiceName, deploy.ID))
+			return
+		}
+		if ok {
+			defer func() { <-workers }()
+			defer unlock()
+			break
+		}
+
+		<-workers
+		if time.Now().After(deadline) {
+			logger.Warn(fmt.Sprintf("[Agent] Deployment %s not resumed: %s/%s stayed locked", deploy.ID, deploy.Application, deploy.ServiceName))
+			return
+		}
+		time.Sleep(lockRetry)
+	}
+
+	ctx, untrack := a.track(ctx, deploy)
+	defer untrack()
+
+	logger.Info(fmt.Sprintf("[Agent] Resuming deployment %s of %s from %s", deploy.ID, deploy.ServiceName, deploy.Step))
+	if err := a.execute(ctx, deploy); err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to resume deployment %s", deploy.ID))
+		a.markFailed(ctx, deploy)
+	}
+}
+
+// track makes the job of a deployment controllable from the control channel until
+// the returned func is called.
+func (a *Agent) track(ctx context.Context, deploy *dto.Deployment) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	job := &inFlightJob{
+		cancel: cancel,
+		gate:   gate.New(deploy.Progression == domain.ProgressionManual),
+	}
+
+	a.mu.Lock()
+	a.inFlight[deploy.ID] = job
+	a.mu.Unlock()
+
+	return gate.WithGate(ctx, job.gate), func() {
+		a.mu.Lock()
+		delete(a.inFlight, deploy.ID)
+		a.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// listenControl follows the control channel for as long as the agent runs and
+// applies the messages sent for the jobs that run here.
+func (a *Agent) listenControl(ctx context.Context) {
+	for {
+		messages, closeSub, err := a.Stream.Subscribe(ctx, store.ControlChannel)
+		if err != nil {
+			logger.WithError(err).Error("[Agent] Failed to subscribe to the control channel")
+			time.Sleep(2 * time.Second)
+			continue
+		}
+
+		for msg := range messages {
+			var control dto.ControlMessage
+			if err := json.Unmarshal([]byte(msg.Payload), &control); err != nil {
+				logger.WithError(err).Warn("[Agent] Invalid control message")
+				continue
 			}
 
-			if procErr != nil {
-				logger.WithError(err).Error(fmt.Sprintf("[Agent] Job %s failed: %v", deploy.ID, deploy.DeploymentStrategy))
+			a.mu.Lock()
+			job, ok := a.inFlight[control.DeploymentID]
+			a.mu.Unlock()
+			if !ok {
 				continue
 			}
 
-			if err := a.Stream.AckJob(a.StreamName, a.GroupName, msg.ID); err != nil {
-				logger.Error(fmt.Sprintf("[Agent] Job %s ACK failed: %v", deploy.ID, err))
-			} else {
-				logger.Info(fmt.Sprintf("[Agent] Job %s ACK done", deploy.ID))
+			logger.Info(fmt.Sprintf("[Agent] Applying %s to deployment %s", control.Type, control.DeploymentID))
+			switch control.Type {
+			case domain.ControlCancel:
+				job.cancel(domain.ErrDeploymentCancelled)
+			case domain.ControlPromote:
+				job.gate.Promote()
+			case domain.ControlPause:
+				job.gate.Pause()
+			case domain.ControlResume:
+				job.gate.Resume()
+			}
+		}
+
+		closeSub()
+	}
+}
+
+// execute runs the job of a deployment, or resumes it when an earlier attempt got
+// past its first step, and records the error it fails with.
+func (a *Agent) execute(ctx context.Context, deploy *dto.Deployment) error {
+	jobCtx := healthcheck.WithObserver(ctx, a.progress.HealthCheckObserver(ctx, deploy))
+
+	var procErr error
+	if deploy.Step != "" && deploy.Step != domain.StepCreating {
+		procErr = a.resume(jobCtx, deploy)
+	} else {
+		procErr = a.run(jobCtx, deploy)
+	}
+
+	if procErr != nil {
+		logger.WithError(procErr).Error(fmt.Sprintf("[Agent] Job %s failed: %v", deploy.ID, deploy.DeploymentStrategy))
+		a.progress.Failed(ctx, deploy, procErr)
+	}
+
+	return procErr
+}
+
+// markFailed records that the job of a deployment gave up, unless the deployment
+// ended in another terminal step already. A cancelled one is marked as cancelled.
+func (a *Agent) markFailed(ctx context.Context, deploy *dto.Deployment) {
+	if domain.IsTerminalStep(deploy.Step) {
+		return
+	}
+
+	if err := a.progress.Step(ctx, deploy, domain.StepFailed); err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to mark job %s as failed", deploy.ID))
+	}
+}
+
+func (a *Agent) run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.DeploymentStrategy {
+	case domain.StrategyBlueGreen:
+		return a.blueGreenJob.Run(ctx, deploy)
+	case domain.StrategyInitialize:
+		return a.initialJob.Run(ctx, deploy)
+	case domain.StrategyRollingUpdate:
+		return a.rollingJob.Run(ctx, deploy)
+	case domain.StrategyCanary:
+		return a.canaryJob.Run(ctx, deploy)
+	case domain.StrategyAllIn:
+		return a.allInJob.Run(ctx, deploy)
+	case domain.StrategyTeardown:
+		return a.teardownJob.Run(ctx, deploy)
+	case domain.StrategyConfigure:
+		return a.configureJob.Run(ctx, deploy)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownStrategy, deploy.DeploymentStrategy)
+	}
+}
+
+func (a *Agent) resume(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.DeploymentStrategy {
+	case domain.StrategyBlueGreen:
+		return a.blueGreenJob.Resume(ctx, deploy)
+	case domain.StrategyInitialize:
+		return a.initialJob.Resume(ctx, deploy)
+	case domain.StrategyRollingUpdate:
+		return a.rollingJob.Resume(ctx, deploy)
+	case domain.StrategyCanary:
+		return a.canaryJob.Resume(ctx, deploy)
+	case domain.StrategyAllIn:
+		return a.allInJob.Resume(ctx, deploy)
+	case domain.StrategyTeardown:
+		return a.teardownJob.Resume(ctx, deploy)
+	case domain.StrategyConfigure:
+		return a.configureJob.Resume(ctx, deploy)
+	default:
+		return fmt.Errorf("%w: %s", errUnknownStrategy, deploy.DeploymentStrategy)
+	}
+}
+
+// tryLockService takes the lock of the service of the deployment for owner when it is
+// free, and keeps it held until the returned func is called.
+func (a *Agent) tryLockService(deploy *dto.Deployment, owner string) (func(), bool, error) {
+	ok, err := a.Locker.AcquireServiceLock(deploy.Application, deploy.ServiceName, owner, lockTTL)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				held, err := a.Locker.RefreshServiceLock(deploy.Application, deploy.ServiceName, owner, lockTTL)
+				if err != nil || !held {
+					logger.Warn(fmt.Sprintf("[Agent] Lost the lock of %s/%s held by job %s: %v", deploy.Application, deploy.ServiceName, deploy.ID, err))
+				}
 			}
 		}
+	}()
+
+	return func() {
+		close(done)
+		if err := a.Locker.ReleaseServiceLock(deploy.Application, deploy.ServiceName, owner); err != nil {
+			logger.WithError(err).Warn(fmt.Sprintf("[Agent] Failed to release the lock of %s/%s", deploy.Application, deploy.ServiceName))
+		}
+	}, true, nil
+}
+
+// keepClaimed keeps resetting the idle time of a job while it runs, so that a long
+// rollout is not taken over by another agent. The returned func stops it.
+func (a *Agent) keepClaimed(job store.PendingJob) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(max(a.ClaimMinIdle/3, time.Second))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := a.Stream.TouchJob(job.Stream, a.GroupName, a.AgentName, job.Message.ID); err != nil {
+					logger.WithError(err).Warn(fmt.Sprintf("[Agent] Failed to keep job entry %s claimed", job.Message.ID))
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+func (a *Agent) ack(job store.PendingJob, deploy *dto.Deployment) {
+	if err := a.Stream.AckJob(job.Stream, a.GroupName, job.Message.ID); err != nil {
+		logger.Error(fmt.Sprintf("[Agent] Job %s ACK failed: %v", deploy.ID, err))
+	} else {
+		logger.Info(fmt.Sprintf("[Agent] Job %s ACK done", deploy.ID))
+	}
+}
+
+func (a *Agent) deadLetter(job store.PendingJob, reason string) {
+	if err := a.Stream.DeadLetterJob(a.GroupName, job, reason); err != nil {
+		logger.WithError(err).Error(fmt.Sprintf("[Agent] Failed to dead-letter job entry %s", job.Message.ID))
+		return
 	}
+	logger.Warn(fmt.Sprintf("[Agent] Job entry %s moved to %s: %s", job.Message.ID, store.DeadLetterStream(job.Stream), reason))
 }
 
 func parseMessage(msg redis.XMessage) (*dto.Deployment, error) {
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// brokenDocker cannot pull any image.
+type brokenDocker struct {
+	docker.DockerClient
+}
+
+func (brokenDocker) EnsureImage(string) (bool, error) {
+	return false, errors.New("registry unreachable")
+}
+
+func (brokenDocker) RemoveSlot(string, string) error {
+	return nil
+}
+
+func newTestAgent(db *fakes.Store, streams *fakes.Streams) *Agent {
+	a := NewAgent("agent-1", []string{"jobs"}, "group", brokenDocker{}, nil, nil, nil, streams, fakes.NewLocker(), db)
+	a.MaxDeliveries = 3
+	return a
+}
+
+func jobMessage(t *testing.T, deploy dto.Deployment) redis.XMessage {
+	t.Helper()
+
+	payload, err := json.Marshal(deploy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return redis.XMessage{ID: "1-0", Values: map[string]interface{}{"payload": string(payload)}}
+}
+
+func TestAgentProcess(t *testing.T) {
+	allIn := dto.Deployment{
+		ID:                 "d1",
+		Application:        "shop",
+		ServiceName:        "api",
+		DeploymentStrategy: domain.StrategyAllIn,
+		Version:            "v2",
+		Action:             domain.ActionDeployCreate,
+		Step:               domain.StepCreating,
+	}
+	invalidAction := allIn
+	invalidAction.Action = "explode"
+	unknownStrategy := allIn
+	unknownStrategy.DeploymentStrategy = "big_bang"
+	finished := allIn
+	finished.Step = domain.StepFinished
+
+	tests := []struct {
+		name           string
+		deploy         *dto.Deployment
+		recorded       *dto.Deployment
+		deliveries     int64
+		wantStep       string
+		wantAcked      bool
+		wantDeadLetter bool
+	}{
+		{name: "invalid payload", deliveries: 1, wantDeadLetter: true},
+		{
+			name:           "unknown strategy",
+			deploy:         &unknownStrategy,
+			recorded:       &unknownStrategy,
+			deliveries:     1,
+			wantStep:       domain.StepFailed,
+			wantDeadLetter: true,
+		},
+		{
+			name:      "already finished",
+			deploy:    &allIn,
+			recorded:  &finished,
+			wantStep:  domain.StepFinished,
+			wantAcked: true,
+		},
+		{
+			name:      "failure recorded by the job",
+			deploy:    &allIn,
+			recorded:  &allIn,
+			wantStep:  domain.StepFailed,
+			wantAcked: true,
+		},
+		{
+			name:       "failure left to retry",
+			deploy:     &invalidAction,
+			recorded:   &invalidAction,
+			deliveries: 1,
+			wantStep:   domain.StepCreating,
+		},
+		{
+			name:           "failure out of deliveries",
+			deploy:         &invalidAction,
+			recorded:       &invalidAction,
+			deliveries:     3,
+			wantStep:       domain.StepFailed,
+			wantDeadLetter: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v1"})
+			if tt.recorded != nil {
+				if err := db.SaveDeployment(context.Background(), *tt.recorded); err != nil {
+					t.Fatal(err)
+				}
+			}
+			streams := fakes.NewStreams()
+			a := newTestAgent(db, streams)
+
+			msg := redis.XMessage{ID: "1-0", Values: map[string]interface{}{"payload": "{"}}
+			if tt.deploy != nil {
+				msg = jobMessage(t, *tt.deploy)
+			}
+			deliveries := max(tt.deliveries, 1)
+
+			if !a.process(context.Background(), store.PendingJob{Stream: "jobs", Message: msg, Deliveries: deliveries}) {
+				t.Fatal("process() = false, want the job handled")
+			}
+
+			if tt.recorded != nil {
+				if got := db.Step(tt.recorded.ID); got != tt.wantStep {
+					t.Errorf("step = %q, want %q", got, tt.wantStep)
+				}
+			}
+			if got := streams.IsAcked(msg.ID); got != tt.wantAcked {
+				t.Errorf("acked = %v, want %v", got, tt.wantAcked)
+			}
+			if _, got := streams.DeadLetterReason(msg.ID); got != tt.wantDeadLetter {
+				t.Errorf("dead-lettered = %v, want %v", got, tt.wantDeadLetter)
+			}
+		})
+	}
+}
+
+func TestAgentReclaimGivesUp(t *testing.T) {
+	running := dto.Deployment{
+		ID:                 "d1",
+		Application:        "shop",
+		ServiceName:        "api",
+		DeploymentStrategy: domain.StrategyAllIn,
+		Version:            "v2",
+		Action:             domain.ActionDeployCreate,
+		Step:               domain.StepSwapTraffic,
+	}
+	rolledBack := running
+	rolledBack.Step = domain.StepRollback
+
+	tests := []struct {
+		name           string
+		recorded       dto.Deployment
+		deliveries     int64
+		wantStep       string
+		wantAcked      bool
+		wantDeadLetter bool
+		wantHeld       bool
+	}{
+		{
+			name:           "poisoned job",
+			recorded:       running,
+			deliveries:     4,
+			wantStep:       domain.StepFailed,
+			wantDeadLetter: true,
+		},
+		{
+			name:       "deployment ended meanwhile",
+			recorded:   rolledBack,
+			deliveries: 4,
+			wantStep:   domain.StepRollback,
+			wantAcked:  true,
+		},
+		{
+			name:       "deliveries left",
+			recorded:   running,
+			deliveries: 3,
+			wantStep:   domain.StepSwapTraffic,
+			wantHeld:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			if err := db.SaveDeployment(context.Background(), tt.recorded); err != nil {
+				t.Fatal(err)
+			}
+			streams := fakes.NewStreams()
+			msg := jobMessage(t, running)
+			streams.Pending["jobs"] = []store.PendingJob{{Stream: "jobs", Message: msg, Deliveries: tt.deliveries}}
+
+			a := newTestAgent(db, streams)
+			a.reclaim()
+
+			if got := db.Step(running.ID); got != tt.wantStep {
+				t.Errorf("step = %q, want %q", got, tt.wantStep)
+			}
+			if !domain.IsTerminalStep(db.Step(running.ID)) && !tt.wantHeld {
+				t.Errorf("step %q is not terminal", db.Step(running.ID))
+			}
+			if got := streams.IsAcked(msg.ID); got != tt.wantAcked {
+				t.Errorf("acked = %v, want %v", got, tt.wantAcked)
+			}
+			if _, got := streams.DeadLetterReason(msg.ID); got != tt.wantDeadLetter {
+				t.Errorf("dead-lettered = %v, want %v", got, tt.wantDeadLetter)
+			}
+			if _, got := a.nextHeld(); got != tt.wantHeld {
+				t.Errorf("held = %v, want %v", got, tt.wantHeld)
+			}
+		})
+	}
+}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"errors"
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
 	"github.com/elissonalvesilva/releasy/internal/core/service/deployment"
+	"github.com/elissonalvesilva/releasy/internal/core/service/job"
 	"github.com/elissonalvesilva/releasy/internal/core/service/service"
 	"github.com/elissonalvesilva/releasy/internal/store"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
 	"github.com/gin-gonic/gin"
+	"io"
+	"strconv"
+	"time"
 )
 
 func (api *API) deploymentHandler(c *gin.Context) {
@@ -24,6 +31,14 @@ func (api *API) deploymentHandler(c *gin.Context) {
 			c.JSON(404, gin.H{"error": "Service not found"})
 			return
 		}
+		if errors.Is(err, domain.ErrDeploymentInProgress) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		if isInvalidDeployment(err) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 
 		c.JSON(500, gin.H{"error": "Failed to create job"})
 		return
@@ -44,6 +59,10 @@ func (api *API) finishDeploymentHandler(c *gin.Context) {
 			c.JSON(404, gin.H{"error": "Service not found"})
 			return
 		}
+		if errors.Is(err, domain.ErrDeploymentNotEffective) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
 		logger.WithError(err).Error("Error executing deployment")
 		c.JSON(500, gin.H{"error": "Failed to create job"})
 		return
@@ -54,48 +73,213 @@ func (api *API) finishDeploymentHandler(c *gin.Context) {
 	})
 }
 
-// func (api *API) rollbackHandler(c *gin.Context) {
-// 	jobID := c.Param("job_id")
+func (api *API) rollbackHandler(c *gin.Context) {
+	jobID := c.Param("job_id")
 
-// 	err := api.DeploymentService.Rollback(c, jobID)
-// 	if err != nil {
-// 		logger.WithError(err).Error("Error executing rollback")
-// 		c.JSON(500, gin.H{"error": "Failed to create job"})
-// 		return
-// 	}
+	err := api.DeploymentService.Rollback(c, jobID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentNotEffective) || errors.Is(err, domain.ErrRollbackNotSupported) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error executing rollback")
+		c.JSON(500, gin.H{"error": "Failed to create job"})
+		return
+	}
 
-// 	c.JSON(201, gin.H{
-// 		"status": "rolling back deployment",
-// 	})
-// }
+	c.JSON(201, gin.H{
+		"status": "rolling back deployment",
+	})
+}
 
-// func (api *API) getDeploymentHandler(c *gin.Context) {
-// 	jobID := c.Param("job_id")
+func (api *API) cancelDeploymentHandler(c *gin.Context) {
+	err := api.DeploymentService.Cancel(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentNotInFlight) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error cancelling deployment")
+		c.JSON(500, gin.H{"error": "Failed to cancel deployment"})
+		return
+	}
 
-// 	deployment, err := api.DeploymentService.GetDeployment(c, jobID)
-// 	if err != nil {
-// 		logger.WithError(err).Error("Error fetching deployment")
-// 		c.JSON(500, gin.H{"error": "Failed to fetch deployment"})
-// 		return
-// 	}
+	c.JSON(202, gin.H{
+		"status": "cancelling deployment",
+	})
+}
+
+func (api *API) promoteDeploymentHandler(c *gin.Context) {
+	api.controlDeployment(c, api.DeploymentService.Promote, "promoting deployment")
+}
+
+func (api *API) pauseDeploymentHandler(c *gin.Context) {
+	api.controlDeployment(c, api.DeploymentService.Pause, "pausing deployment")
+}
+
+func (api *API) resumeDeploymentHandler(c *gin.Context) {
+	api.controlDeployment(c, api.DeploymentService.Resume, "resuming deployment")
+}
+
+func (api *API) controlDeployment(c *gin.Context, control func(ctx context.Context, id string) error, status string) {
+	err := control(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentNotInFlight) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error controlling deployment")
+		c.JSON(500, gin.H{"error": "Failed to control deployment"})
+		return
+	}
 
-// 	c.JSON(200, gin.H{
-// 		"deployment": deployment,
-// 	})
-// }
+	c.JSON(202, gin.H{
+		"status": status,
+	})
+}
 
-// func (api *API) getDeploymentsHandler(c *gin.Context) {
-// 	deployments, err := api.DeploymentService.GetDeployments(c)
-// 	if err != nil {
-// 		logger.WithError(err).Error("Error fetching deployments")
-// 		c.JSON(500, gin.H{"error": "Failed to fetch deployments"})
-// 		return
-// 	}
+func (api *API) getDeploymentHandler(c *gin.Context) {
+	id := c.Param("id")
 
-// 	c.JSON(200, gin.H{
-// 		"deployments": deployments,
-// 	})
-// }
+	deployment, err := api.DeploymentService.Get(c, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		logger.WithError(err).Error("Error fetching deployment")
+		c.JSON(500, gin.H{"error": "Failed to fetch deployment"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"deployment": deployment,
+	})
+}
+
+func (api *API) getDeploymentsHandler(c *gin.Context) {
+	query := deployment.ListDeploymentsQuery{
+		Application: c.Param("app"),
+		ServiceName: c.Param("name"),
+		Strategy:    c.Query("strategy"),
+		Step:        c.Query("step"),
+		Version:     c.Query("version"),
+		Page:        queryInt(c, "page", 1),
+		PerPage:     queryInt(c, "per_page", deployment.DefaultPerPage),
+	}.WithDefaults()
+
+	deployments, total, err := api.DeploymentService.List(c, query)
+	if err != nil {
+		logger.WithError(err).Error("Error fetching deployments")
+		c.JSON(500, gin.H{"error": "Failed to fetch deployments"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"deployments": deployments,
+		"page":        query.Page,
+		"per_page":    query.PerPage,
+		"total":       total,
+	})
+}
+
+func (api *API) getDeploymentEventsHandler(c *gin.Context) {
+	events, err := api.DeploymentService.Events(c, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		logger.WithError(err).Error("Error fetching deployment events")
+		c.JSON(500, gin.H{"error": "Failed to fetch deployment events"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"events": events,
+	})
+}
+
+func (api *API) getServiceEventsHandler(c *gin.Context) {
+	events, err := api.DeploymentService.ServiceEvents(c, c.Param("app"), c.Param("name"), queryInt(c, "limit", deployment.DefaultEventsLimit))
+	if err != nil {
+		logger.WithError(err).Error("Error fetching service events")
+		c.JSON(500, gin.H{"error": "Failed to fetch service events"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"events": events,
+	})
+}
+
+// streamDeploymentHandler pushes the progress of a deployment as Server-Sent Events
+// until it reaches a terminal step or the client goes away.
+func (api *API) streamDeploymentHandler(c *gin.Context) {
+	id := c.Param("id")
+	ctx := c.Request.Context()
+
+	// Subscribe before reading the current step so no transition is lost in between.
+	events, closeFn, err := api.DeploymentService.Watch(ctx, id)
+	if err != nil {
+		logger.WithError(err).Error("Error watching deployment")
+		c.JSON(500, gin.H{"error": "Failed to watch deployment"})
+		return
+	}
+	defer closeFn()
+
+	current, err := api.DeploymentService.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Deployment not found"})
+			return
+		}
+		logger.WithError(err).Error("Error fetching deployment")
+		c.JSON(500, gin.H{"error": "Failed to fetch deployment"})
+		return
+	}
+
+	c.SSEvent(domain.ProgressStep, dto.DeploymentProgress{
+		DeploymentID: current.ID,
+		Type:         domain.ProgressStep,
+		Step:         current.Step,
+		CreatedAt:    current.UpdatedAt,
+	})
+	if domain.IsTerminalStep(current.Step) {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return !domain.IsTerminalStep(event.Step)
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", time.Now())
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
 
 // service handlers
 
@@ -113,6 +297,10 @@ func (api *API) createServiceHandler(c *gin.Context) {
 			c.JSON(409, gin.H{"error": "Service already exists"})
 			return
 		}
+		if isInvalidServiceSpec(err) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
 
 		logger.WithError(err).Error("Error creating service")
 		c.JSON(500, gin.H{"error": "Failed to create service"})
@@ -124,45 +312,230 @@ func (api *API) createServiceHandler(c *gin.Context) {
 	})
 }
 
-// 	c.JSON(201, gin.H{
-// 		"status": "service created",
-// 	})
-// }
+func (api *API) listServicesHandler(c *gin.Context) {
+	services, err := api.ServiceService.List(c, c.Query("application"))
+	if err != nil {
+		logger.WithError(err).Error("Error fetching services")
+		c.JSON(500, gin.H{"error": "Failed to fetch services"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"services": services,
+	})
+}
+
+func (api *API) getServiceHandler(c *gin.Context) {
+	svc, err := api.ServiceService.Get(c, c.Param("app"), c.Param("name"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Service not found"})
+			return
+		}
+		logger.WithError(err).Error("Error fetching service")
+		c.JSON(500, gin.H{"error": "Failed to fetch service"})
+		return
+	}
 
-// func (api *API) updateServiceHandler(c *gin.Context) {
-// 	var req deployment.ServiceCommand
+	c.JSON(200, gin.H{
+		"service": svc,
+	})
+}
 
-// 	if err := c.ShouldBindJSON(&req); err != nil {
-// 		c.JSON(400, gin.H{"error": "Invalid JSON"})
-// 		return
-// 	}
+// isInvalidDeployment reports whether err rejects a part of a deployment request.
+func isInvalidDeployment(err error) bool {
+	for _, invalid := range []error{
+		domain.ErrDeploymentNameIsInvalid,
+		domain.ErrActionIsInvalid,
+		domain.ErrRollingUpdateIsInvalid,
+		domain.ErrHealthCheckIsInvalid,
+		domain.ErrCanaryStepsIsInvalid,
+		domain.ErrCanaryReplicasIsInvalid,
+		domain.ErrAnalysisIsInvalid,
+		domain.ErrServiceStrategyIsInvalid,
+		domain.ErrProgressionIsInvalid,
+		domain.ErrProgressionNotSupported,
+		domain.ErrAutoFinishIsInvalid,
+		domain.ErrAutoFinishNotSupported,
+		domain.ErrRouteIsInvalid,
+		domain.ErrTLSIsInvalid,
+		domain.ErrMiddlewareIsInvalid,
+	} {
+		if errors.Is(err, invalid) {
+			return true
+		}
+	}
+	return false
+}
 
-// 	err := api.DeploymentService.UpdateService(c, req)
-// 	if err != nil {
-// 		logger.WithError(err).Error("Error updating service")
-// 		c.JSON(500, gin.H{"error": "Failed to update service"})
-// 		return
-// 	}
+// isInvalidServiceSpec reports whether err rejects a part of a service definition.
+func isInvalidServiceSpec(err error) bool {
+	for _, invalid := range []error{
+		domain.ErrServiceStrategyIsInvalid,
+		domain.ErrReplicasIsInvalid,
+		domain.ErrHealthCheckIsInvalid,
+		domain.ErrRouteIsInvalid,
+		domain.ErrTLSIsInvalid,
+		domain.ErrMiddlewareIsInvalid,
+	} {
+		if errors.Is(err, invalid) {
+			return true
+		}
+	}
+	return false
+}
 
-// 	c.JSON(201, gin.H{
-// 		"status": "service updated",
-// 	})
-// }
+func (api *API) updateServiceHandler(c *gin.Context) {
+	var req service.UpdateServiceCommand
 
-// func (api *API) deleteServiceHandler(c *gin.Context) {
-// 	var req deployment.ServiceCommand
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON"})
+		return
+	}
 
-// 	if err := c.ShouldBindJSON(&req); err != nil {
-// 		c.JSON(400, gin.H{"error": "Invalid JSON"})
-// 		return
-// 	}
+	jobID, err := api.ServiceService.Update(c, c.Param("app"), c.Param("name"), req)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Service not found"})
+			return
+		}
+		if isInvalidServiceSpec(err) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentInProgress) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error updating service")
+		c.JSON(500, gin.H{"error": "Failed to update service"})
+		return
+	}
+
+	if jobID == "" {
+		c.JSON(200, gin.H{
+			"status": "service updated",
+		})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"status": "service updated, applying",
+		"job_id": jobID,
+	})
+}
 
-// 	err := api.DeploymentService.DeleteService(c, req)
-// 	if err != nil {
-// 		logger.WithError(err).Error("Error deleting service")
-// 		c.JSON(500, gin.H{"error": "Failed to delete service"})
-// 		return
-// 	}
+func (api *API) deleteServiceHandler(c *gin.Context) {
+	jobID, err := api.ServiceService.Delete(c, c.Param("app"), c.Param("name"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Service not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentInProgress) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error deleting service")
+		c.JSON(500, gin.H{"error": "Failed to delete service"})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"status": "deleting service",
+		"job_id": jobID,
+	})
+}
 
-// 	c.JSON(204, gin.H{})
-// }
+func (api *API) setCertificateHandler(c *gin.Context) {
+	var req dto.Certificate
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	api.updateCertificate(c, func() (string, error) {
+		return api.ServiceService.SetCertificate(c, c.Param("app"), c.Param("name"), req)
+	})
+}
+
+func (api *API) removeCertificateHandler(c *gin.Context) {
+	api.updateCertificate(c, func() (string, error) {
+		return api.ServiceService.RemoveCertificate(c, c.Param("app"), c.Param("name"))
+	})
+}
+
+// updateCertificate answers a change of the certificate of a service, applied by the job
+// that fn queues.
+func (api *API) updateCertificate(c *gin.Context, fn func() (string, error)) {
+	jobID, err := fn()
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Service not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrCertificateIsInvalid) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error updating certificate")
+		c.JSON(500, gin.H{"error": "Failed to update certificate"})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"status": "certificate updated, applying",
+		"job_id": jobID,
+	})
+}
+
+func (api *API) listDeadLettersHandler(c *gin.Context) {
+	deadLetters, err := api.JobService.ListDeadLetters(c.Query("stream"), queryInt(c, "limit", job.DefaultDeadLettersLimit))
+	if err != nil {
+		if errors.Is(err, job.ErrUnknownStream) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error fetching dead letters")
+		c.JSON(500, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"dead_letters": deadLetters,
+	})
+}
+
+func (api *API) requeueDeadLetterHandler(c *gin.Context) {
+	entryID, err := api.JobService.Requeue(c, c.Query("stream"), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, job.ErrUnknownStream) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(404, gin.H{"error": "Dead letter not found"})
+			return
+		}
+		if errors.Is(err, domain.ErrDeploymentInProgress) {
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
+		logger.WithError(err).Error("Error requeueing dead letter")
+		c.JSON(500, gin.H{"error": "Failed to requeue dead letter"})
+		return
+	}
+
+	c.JSON(202, gin.H{
+		"entry_id": entryID,
+	})
+}
+
+func queryInt(c *gin.Context, key string, fallback int) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
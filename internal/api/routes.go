@@ -12,7 +12,25 @@ func (api *API) healthHandler(c *gin.Context) {
 func (api *API) registerRoutes() {
 	api.Router.GET("/ping", api.healthHandler)
 
+	api.Router.GET("/services", api.listServicesHandler)
 	api.Router.POST("/services", api.createServiceHandler)
+	api.Router.GET("/services/:app/:name", api.getServiceHandler)
+	api.Router.PUT("/services/:app/:name", api.updateServiceHandler)
+	api.Router.DELETE("/services/:app/:name", api.deleteServiceHandler)
+	api.Router.PUT("/services/:app/:name/certificate", api.setCertificateHandler)
+	api.Router.DELETE("/services/:app/:name/certificate", api.removeCertificateHandler)
+	api.Router.GET("/services/:app/:name/deployments", api.getDeploymentsHandler)
+	api.Router.GET("/services/:app/:name/events", api.getServiceEventsHandler)
 	api.Router.POST("/deployment", api.deploymentHandler)
 	api.Router.PUT("/deployment/finish/:job_id", api.finishDeploymentHandler)
+	api.Router.POST("/deployment/rollback/:job_id", api.rollbackHandler)
+	api.Router.GET("/deployments/:id", api.getDeploymentHandler)
+	api.Router.GET("/deployments/:id/stream", api.streamDeploymentHandler)
+	api.Router.GET("/deployments/:id/events", api.getDeploymentEventsHandler)
+	api.Router.POST("/deployments/:id/cancel", api.cancelDeploymentHandler)
+	api.Router.POST("/deployments/:id/promote", api.promoteDeploymentHandler)
+	api.Router.POST("/deployments/:id/pause", api.pauseDeploymentHandler)
+	api.Router.POST("/deployments/:id/resume", api.resumeDeploymentHandler)
+	api.Router.GET("/jobs/dead-letters", api.listDeadLettersHandler)
+	api.Router.POST("/jobs/dead-letters/:id/requeue", api.requeueDeadLetterHandler)
 }
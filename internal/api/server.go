@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/elissonalvesilva/releasy/internal/core/service/deployment"
+	"github.com/elissonalvesilva/releasy/internal/core/service/job"
 	"github.com/elissonalvesilva/releasy/internal/core/service/service"
 	"github.com/elissonalvesilva/releasy/internal/store"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
@@ -14,6 +15,7 @@ type (
 		Streams           store.Streams
 		DeploymentService *deployment.DeploymentService
 		ServiceService    *service.ServiceService
+		JobService        *job.JobService
 	}
 )
 
@@ -21,6 +23,7 @@ func NewAPI(
 	streams store.Streams,
 	deploymentService *deployment.DeploymentService,
 	serviceService *service.ServiceService,
+	jobService *job.JobService,
 ) *API {
 	r := gin.Default()
 	api := &API{
@@ -28,6 +31,7 @@ func NewAPI(
 		Streams:           streams,
 		DeploymentService: deploymentService,
 		ServiceService:    serviceService,
+		JobService:        jobService,
 	}
 	api.registerRoutes()
 	return api
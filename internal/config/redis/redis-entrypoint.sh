@@ -9,8 +9,5 @@ done
 
 echo "✅ Redis is ready!"
 
-echo "🔄 Creating a stream 'releasy_jobs' e group 'releasy-group'..."
-redis-cli XGROUP CREATE releasy_jobs releasy-group \$ MKSTREAM || echo "ℹ️ Group already exists, ignoring."
-
 echo "🚀 it's ready!"
 wait
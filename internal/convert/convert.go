@@ -0,0 +1,91 @@
+// Package convert maps the health checks and TLS options of a service between the
+// API, the domain and the Docker client.
+package convert
+
+import (
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+)
+
+func ToDomainHealthCheck(h dto.HealthCheck) domain.HealthCheck {
+	return domain.HealthCheck{
+		Type:             h.Type,
+		Path:             h.Path,
+		Method:           h.Method,
+		Headers:          h.Headers,
+		ExpectedStatus:   h.ExpectedStatus,
+		BodyContains:     h.BodyContains,
+		BodyJSONPath:     h.BodyJSONPath,
+		BodyJSONValue:    h.BodyJSONValue,
+		TimeoutSeconds:   h.TimeoutSeconds,
+		SuccessThreshold: h.SuccessThreshold,
+		FailureThreshold: h.FailureThreshold,
+		Command:          h.Command,
+		GRPCService:      h.GRPCService,
+		QuorumPercent:    h.QuorumPercent,
+	}
+}
+
+func ToDTOHealthCheck(h domain.HealthCheck) dto.HealthCheck {
+	return dto.HealthCheck{
+		Type:             h.Type,
+		Path:             h.Path,
+		Method:           h.Method,
+		Headers:          h.Headers,
+		ExpectedStatus:   h.ExpectedStatus,
+		BodyContains:     h.BodyContains,
+		BodyJSONPath:     h.BodyJSONPath,
+		BodyJSONValue:    h.BodyJSONValue,
+		TimeoutSeconds:   h.TimeoutSeconds,
+		SuccessThreshold: h.SuccessThreshold,
+		FailureThreshold: h.FailureThreshold,
+		Command:          h.Command,
+		GRPCService:      h.GRPCService,
+		QuorumPercent:    h.QuorumPercent,
+	}
+}
+
+func ToDomainDockerHealthCheck(h dto.DockerHealthCheck) domain.DockerHealthCheck {
+	return domain.DockerHealthCheck{
+		Test:               h.Test,
+		IntervalSeconds:    h.IntervalSeconds,
+		TimeoutSeconds:     h.TimeoutSeconds,
+		StartPeriodSeconds: h.StartPeriodSeconds,
+		Retries:            h.Retries,
+		Disable:            h.Disable,
+	}
+}
+
+func ToDTODockerHealthCheck(h domain.DockerHealthCheck) dto.DockerHealthCheck {
+	return dto.DockerHealthCheck{
+		Test:               h.Test,
+		IntervalSeconds:    h.IntervalSeconds,
+		TimeoutSeconds:     h.TimeoutSeconds,
+		StartPeriodSeconds: h.StartPeriodSeconds,
+		Retries:            h.Retries,
+		Disable:            h.Disable,
+	}
+}
+
+// ToDockerHealthCheck is the health check the containers of a slot are started with.
+func ToDockerHealthCheck(h dto.DockerHealthCheck) docker.HealthCheck {
+	return docker.HealthCheck{
+		Test:        h.Test,
+		Interval:    time.Duration(h.IntervalSeconds) * time.Second,
+		Timeout:     time.Duration(h.TimeoutSeconds) * time.Second,
+		StartPeriod: time.Duration(h.StartPeriodSeconds) * time.Second,
+		Retries:     h.Retries,
+		Disable:     h.Disable,
+	}
+}
+
+func ToDomainTLS(t dto.TLS) domain.TLS {
+	return domain.TLS{
+		Enabled:      t.Enabled,
+		CertResolver: t.CertResolver,
+		RedirectHTTP: t.RedirectHTTP,
+	}
+}
@@ -22,13 +22,55 @@ type (
 		Version             string
 		Action              string
 		Step                string
-		CreatedAt           time.Time
+		BatchSize           int
+		MaxUnavailable      int
+		CanarySteps         []CanaryStep
+		CanaryReplicas      int
+		MaxErrorRate        float64
+		FailureThreshold    int
+		Progression         string
+		AutoFinishAfter     int
+		HealthCheck         HealthCheck
+		DockerHealthCheck   DockerHealthCheck
+		// Previous is the spec of the slot serving before the deployment, which a
+		// rollback restores.
+		Previous *ServiceSpec
+		// Pending is the spec a redeploy changes, recorded on the service only once
+		// the deployment finished.
+		Pending   *ServiceSpec
+		CreatedAt time.Time
+	}
+
+	ServiceSpec struct {
+		Image             string
+		Replicas          int
+		Envs              string
+		DockerHealthCheck DockerHealthCheck
+	}
+
+	CanaryStep struct {
+		Weight int
+		Bake   int
 	}
 )
 
 var (
 	ErrDeploymentNameIsInvalid = errors.New("deployment name is invalid")
 	ErrActionIsInvalid         = errors.New("action is invalid")
+	ErrRollingUpdateIsInvalid  = errors.New("rolling update batch size or max unavailable is invalid")
+	ErrCanaryStepsIsInvalid    = errors.New("canary steps must have increasing weights between 1 and 100")
+	ErrCanaryReplicasIsInvalid = errors.New("canary replicas must be between 1 and the service replicas")
+	ErrDeploymentNotEffective  = errors.New("deployment is not effective")
+	ErrAnalysisIsInvalid       = errors.New("max error rate must be between 0 and 1 and failure threshold positive")
+	ErrRollbackNotSupported    = errors.New("rollback is not supported for this strategy")
+	ErrDeploymentInterrupted   = errors.New("deployment was interrupted before it completed")
+	ErrDeploymentInProgress    = errors.New("another deployment of this service is in progress")
+	ErrDeploymentCancelled     = errors.New("deployment cancelled")
+	ErrDeploymentNotInFlight   = errors.New("deployment is not in flight")
+	ErrProgressionIsInvalid    = errors.New("progression must be auto or manual")
+	ErrProgressionNotSupported = errors.New("manual progression is only supported for blue_green and canary")
+	ErrAutoFinishIsInvalid     = errors.New("auto finish after must not be negative")
+	ErrAutoFinishNotSupported  = errors.New("auto finish is only supported for blue_green")
 )
 
 const (
@@ -37,6 +79,8 @@ const (
 	StrategyCanary        = "canary"
 	StrategyAllIn         = "all_in"
 	StrategyInitialize    = "initialize"
+	StrategyTeardown      = "teardown"
+	StrategyConfigure     = "configure"
 )
 
 var allowed = map[string]bool{
@@ -45,39 +89,82 @@ var allowed = map[string]bool{
 	StrategyCanary:        true,
 	StrategyAllIn:         true,
 	StrategyInitialize:    true,
+	StrategyTeardown:      true,
+	StrategyConfigure:     true,
 }
 
 const (
 	ActionDeployCreate   = "create"
 	ActionDeployFinish   = "finish"
 	ActionDeployRollback = "rollback"
+	ActionServiceDelete  = "delete"
+	ActionRoutesUpdate   = "update_routes"
 )
 
 var allowedActions = map[string]bool{
 	ActionDeployCreate:   true,
 	ActionDeployFinish:   true,
 	ActionDeployRollback: true,
+	ActionServiceDelete:  true,
+	ActionRoutesUpdate:   true,
 }
 
 const (
-	StepCreating      = "creating"
-	StepCreatingInfra = "creating_infra"
-	StepSwapTraffic   = "swap_traffic"
-	StepFinishing     = "finishing"
-	StepRollback      = "rollback"
-	StepRunning       = "running"
-	StepEffective     = "effective"
-	StepFinished      = "finished"
-	StepFailed        = "failed"
-	StepRollBacking   = "rollbacking"
+	StepCreating          = "creating"
+	StepCreatingInfra     = "creating_infra"
+	StepSwapTraffic       = "swap_traffic"
+	StepFinishing         = "finishing"
+	StepRollback          = "rollback"
+	StepRunning           = "running"
+	StepEffective         = "effective"
+	StepFinished          = "finished"
+	StepFailed            = "failed"
+	StepRollBacking       = "rollbacking"
+	StepRemoving          = "removing"
+	StepConfiguring       = "configuring"
+	StepCancelled         = "cancelled"
+	StepPaused            = "paused"
+	StepAwaitingPromotion = "awaiting_promotion"
+)
+
+const (
+	ProgressionAuto   = "auto"
+	ProgressionManual = "manual"
+)
+
+const (
+	ProgressStep    = "step"
+	ProgressWeights = "weights"
+	ProgressEvent   = "event"
+
+	ControlCancel  = "cancel"
+	ControlPromote = "promote"
+	ControlPause   = "pause"
+	ControlResume  = "resume"
+)
+
+const (
+	EventImagePulled      = "image_pulled"
+	EventImagePresent     = "image_present"
+	EventContainerStarted = "container_started"
+	EventHealthCheck      = "health_check"
+	EventWeightChanged    = "weight_changed"
+	EventSlotRemoved      = "slot_removed"
+	EventEffectiveOverdue = "effective_overdue"
+	EventError            = "error"
 )
 
 const (
 	DefaultServicePort                = 8080
 	DefaultHealthCheckIntervalSeconds = 30
 	DefaultMaxWaitTimeSeconds         = 600
+	DefaultBatchSize                  = 1
+	DefaultCanaryReplicas             = 1
+	DefaultFailureThreshold           = 3
 )
 
+var DefaultCanaryWeights = []int{1, 5, 25, 50, 100}
+
 func NewDeployment(deploymentStrategy, action, application, serviceName, image, version string, replicas, swapInterval, healthCheckInterval, maxWaitTime int, envs []string) (*Deployment, error) {
 	if deploymentStrategy == "" || !isValidStrategy(deploymentStrategy) {
 		return nil, ErrDeploymentNameIsInvalid
@@ -108,10 +195,143 @@ func NewDeployment(deploymentStrategy, action, application, serviceName, image,
 		Version:             version,
 		Action:              action,
 		Step:                StepCreating,
+		Progression:         ProgressionAuto,
 		CreatedAt:           time.Now(),
 	}, nil
 }
 
+func (d *Deployment) SetRollingUpdate(batchSize, maxUnavailable int) error {
+	if batchSize < 0 || maxUnavailable < 0 {
+		return ErrRollingUpdateIsInvalid
+	}
+
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	d.BatchSize = batchSize
+	d.MaxUnavailable = maxUnavailable
+	return nil
+}
+
+// SetCanary validates the traffic steps of a canary release. When no step is given the
+// default weights are used, baking each one for the swap interval. A final 100% step is
+// appended when the last one does not promote the candidate.
+func (d *Deployment) SetCanary(steps []CanaryStep, replicas int) error {
+	if len(steps) == 0 {
+		for _, weight := range DefaultCanaryWeights {
+			steps = append(steps, CanaryStep{Weight: weight, Bake: d.SwapInterval})
+		}
+	}
+
+	previous := 0
+	for _, step := range steps {
+		if step.Weight <= previous || step.Weight > 100 || step.Bake < 0 {
+			return ErrCanaryStepsIsInvalid
+		}
+		previous = step.Weight
+	}
+
+	if previous != 100 {
+		steps = append(steps, CanaryStep{Weight: 100})
+	}
+
+	if replicas == 0 {
+		replicas = min(DefaultCanaryReplicas, d.Replicas)
+	}
+
+	if replicas < 1 || replicas > d.Replicas {
+		return ErrCanaryReplicasIsInvalid
+	}
+
+	d.CanarySteps = steps
+	d.CanaryReplicas = replicas
+	return nil
+}
+
+// SetAnalysis configures when a candidate is rolled back automatically while it receives
+// traffic. A zero maxErrorRate only watches the candidate health checks.
+func (d *Deployment) SetAnalysis(maxErrorRate float64, failureThreshold int) error {
+	if maxErrorRate < 0 || maxErrorRate > 1 || failureThreshold < 0 {
+		return ErrAnalysisIsInvalid
+	}
+
+	if failureThreshold == 0 {
+		failureThreshold = DefaultFailureThreshold
+	}
+
+	d.MaxErrorRate = maxErrorRate
+	d.FailureThreshold = failureThreshold
+	return nil
+}
+
+// SetProgression chooses whether the traffic steps of a blue/green or canary release
+// are taken automatically or one at a time, on promotion.
+func (d *Deployment) SetProgression(progression string) error {
+	switch progression {
+	case "", ProgressionAuto:
+		d.Progression = ProgressionAuto
+		return nil
+	case ProgressionManual:
+		if d.DeploymentStrategy != StrategyBlueGreen && d.DeploymentStrategy != StrategyCanary {
+			return ErrProgressionNotSupported
+		}
+		d.Progression = ProgressionManual
+		return nil
+	default:
+		return ErrProgressionIsInvalid
+	}
+}
+
+// SetAutoFinish makes a blue/green release finish on its own once its candidate stayed
+// healthy for seconds after receiving all of the traffic. Zero leaves it to be finished by hand.
+func (d *Deployment) SetAutoFinish(seconds int) error {
+	if seconds < 0 {
+		return ErrAutoFinishIsInvalid
+	}
+
+	if seconds > 0 && d.DeploymentStrategy != StrategyBlueGreen {
+		return ErrAutoFinishNotSupported
+	}
+
+	d.AutoFinishAfter = seconds
+	return nil
+}
+
+// SetHealthCheck validates how the instances of the deployment are probed.
+func (d *Deployment) SetHealthCheck(healthCheck HealthCheck) error {
+	if err := healthCheck.Validate(); err != nil {
+		return err
+	}
+
+	d.HealthCheck = healthCheck
+	return nil
+}
+
+// SetDockerHealthCheck validates the health check Docker runs in the new containers.
+func (d *Deployment) SetDockerHealthCheck(healthCheck DockerHealthCheck) error {
+	if err := healthCheck.Validate(); err != nil {
+		return err
+	}
+
+	d.DockerHealthCheck = healthCheck
+	return nil
+}
+
+// TerminalSteps are the steps after which a deployment will not change anymore. The
+// index of active deployments in the store lists them too.
+var TerminalSteps = []string{StepFinished, StepFailed, StepRollback, StepCancelled}
+
+// IsTerminalStep reports whether a deployment in this step will not change anymore.
+func IsTerminalStep(step string) bool {
+	for _, terminal := range TerminalSteps {
+		if step == terminal {
+			return true
+		}
+	}
+	return false
+}
+
 func isValidStrategy(strategy string) bool {
 	return allowed[strategy]
 }
@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"errors"
+	"net/http"
+)
+
+// HealthCheck describes how an instance is probed. Zero fields fall back to the defaults
+// of the checker: an HTTP GET /ping answering 200, one success needed.
+type HealthCheck struct {
+	Type             string
+	Path             string
+	Method           string
+	Headers          map[string]string
+	ExpectedStatus   []int
+	BodyContains     string
+	BodyJSONPath     string
+	BodyJSONValue    string
+	TimeoutSeconds   int
+	SuccessThreshold int
+	FailureThreshold int
+	Command          []string
+	GRPCService      string
+	QuorumPercent    int
+}
+
+var ErrHealthCheckIsInvalid = errors.New("health check is invalid")
+
+const (
+	HealthCheckHTTP = "http"
+	HealthCheckTCP  = "tcp"
+	HealthCheckGRPC = "grpc"
+	HealthCheckExec = "exec"
+)
+
+var healthCheckTypes = map[string]bool{
+	"":              true,
+	HealthCheckHTTP: true,
+	HealthCheckTCP:  true,
+	HealthCheckGRPC: true,
+	HealthCheckExec: true,
+}
+
+var healthCheckMethods = map[string]bool{
+	"":                 true,
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodOptions: true,
+}
+
+// Validate checks that the health check can be run.
+func (h HealthCheck) Validate() error {
+	if !healthCheckTypes[h.Type] {
+		return ErrHealthCheckIsInvalid
+	}
+
+	if h.Type == HealthCheckExec && len(h.Command) == 0 {
+		return ErrHealthCheckIsInvalid
+	}
+
+	if !healthCheckMethods[h.Method] {
+		return ErrHealthCheckIsInvalid
+	}
+
+	if h.Path != "" && h.Path[0] != '/' {
+		return ErrHealthCheckIsInvalid
+	}
+
+	for _, status := range h.ExpectedStatus {
+		if status < 100 || status > 599 {
+			return ErrHealthCheckIsInvalid
+		}
+	}
+
+	if h.BodyJSONValue != "" && h.BodyJSONPath == "" {
+		return ErrHealthCheckIsInvalid
+	}
+
+	if h.QuorumPercent < 0 || h.QuorumPercent > 100 {
+		return ErrHealthCheckIsInvalid
+	}
+
+	if h.TimeoutSeconds < 0 || h.SuccessThreshold < 0 || h.FailureThreshold < 0 {
+		return ErrHealthCheckIsInvalid
+	}
+
+	return nil
+}
+
+// Override returns h with every field set in o replacing its own.
+func (h HealthCheck) Override(o HealthCheck) HealthCheck {
+	if o.Type != "" {
+		h.Type = o.Type
+	}
+	if o.Path != "" {
+		h.Path = o.Path
+	}
+	if o.Method != "" {
+		h.Method = o.Method
+	}
+	if o.Headers != nil {
+		h.Headers = o.Headers
+	}
+	if o.ExpectedStatus != nil {
+		h.ExpectedStatus = o.ExpectedStatus
+	}
+	if o.BodyContains != "" {
+		h.BodyContains = o.BodyContains
+	}
+	if o.BodyJSONPath != "" {
+		h.BodyJSONPath = o.BodyJSONPath
+		h.BodyJSONValue = o.BodyJSONValue
+	}
+	if o.TimeoutSeconds != 0 {
+		h.TimeoutSeconds = o.TimeoutSeconds
+	}
+	if o.SuccessThreshold != 0 {
+		h.SuccessThreshold = o.SuccessThreshold
+	}
+	if o.FailureThreshold != 0 {
+		h.FailureThreshold = o.FailureThreshold
+	}
+	if o.Command != nil {
+		h.Command = o.Command
+	}
+	if o.GRPCService != "" {
+		h.GRPCService = o.GRPCService
+	}
+	if o.QuorumPercent != 0 {
+		h.QuorumPercent = o.QuorumPercent
+	}
+	return h
+}
+
+// DockerHealthCheck is the HEALTHCHECK Docker runs inside the containers. Without a
+// test the containers keep the one of their image, and Disable turns it off.
+type DockerHealthCheck struct {
+	Test               []string
+	IntervalSeconds    int
+	TimeoutSeconds     int
+	StartPeriodSeconds int
+	Retries            int
+	Disable            bool
+}
+
+// Validate checks that Docker can run the health check.
+func (h DockerHealthCheck) Validate() error {
+	if len(h.Test) > 0 {
+		if h.Disable || len(h.Test) < 2 {
+			return ErrHealthCheckIsInvalid
+		}
+
+		if h.Test[0] != "CMD" && h.Test[0] != "CMD-SHELL" {
+			return ErrHealthCheckIsInvalid
+		}
+	}
+
+	if h.IntervalSeconds < 0 || h.TimeoutSeconds < 0 || h.StartPeriodSeconds < 0 || h.Retries < 0 {
+		return ErrHealthCheckIsInvalid
+	}
+
+	return nil
+}
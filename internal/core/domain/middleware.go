@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+type (
+	// Middlewares are the protections and rewrites Traefik applies to the requests of a
+	// service before they reach it. A nil or zero field leaves that middleware out.
+	Middlewares struct {
+		RateLimit      *RateLimit
+		Headers        *Headers
+		BasicAuth      *BasicAuth
+		Retry          *Retry
+		Compress       bool
+		StripPrefix    []string
+		IPAllowList    []string
+		CircuitBreaker string
+	}
+
+	// RateLimit allows Average requests per period on average, and bursts of Burst.
+	RateLimit struct {
+		Average       int
+		Burst         int
+		PeriodSeconds int
+	}
+
+	// Headers adds headers to the requests and responses, and answers CORS requests.
+	Headers struct {
+		CustomRequestHeaders          map[string]string
+		CustomResponseHeaders         map[string]string
+		AccessControlAllowOrigins     []string
+		AccessControlAllowMethods     []string
+		AccessControlAllowHeaders     []string
+		AccessControlAllowCredentials bool
+		AccessControlMaxAge           int
+		STSSeconds                    int
+		FrameDeny                     bool
+		ContentTypeNosniff            bool
+		BrowserXSSFilter              bool
+		ReferrerPolicy                string
+	}
+
+	// BasicAuth lets in the users given as htpasswd lines.
+	BasicAuth struct {
+		Users []string
+		Realm string
+	}
+
+	// Retry sends a request again up to Attempts times when the instance cannot be reached.
+	Retry struct {
+		Attempts          int
+		InitialIntervalMs int
+	}
+)
+
+var ErrMiddlewareIsInvalid = errors.New("middleware is invalid")
+
+// Validate checks that every middleware can be rendered for Traefik.
+func (m Middlewares) Validate() error {
+	if r := m.RateLimit; r != nil && (r.Average <= 0 || r.Burst < 0 || r.PeriodSeconds < 0) {
+		return ErrMiddlewareIsInvalid
+	}
+
+	if h := m.Headers; h != nil && (h.AccessControlMaxAge < 0 || h.STSSeconds < 0) {
+		return ErrMiddlewareIsInvalid
+	}
+
+	if b := m.BasicAuth; b != nil {
+		if len(b.Users) == 0 {
+			return ErrMiddlewareIsInvalid
+		}
+		for _, user := range b.Users {
+			if name, hash, ok := strings.Cut(user, ":"); !ok || name == "" || hash == "" {
+				return ErrMiddlewareIsInvalid
+			}
+		}
+	}
+
+	if r := m.Retry; r != nil && (r.Attempts <= 0 || r.InitialIntervalMs < 0) {
+		return ErrMiddlewareIsInvalid
+	}
+
+	for _, prefix := range m.StripPrefix {
+		if prefix == "" || prefix[0] != '/' {
+			return ErrMiddlewareIsInvalid
+		}
+	}
+
+	for _, source := range m.IPAllowList {
+		if _, _, err := net.ParseCIDR(source); err != nil && net.ParseIP(source) == nil {
+			return ErrMiddlewareIsInvalid
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Route is one way requests reach a service. Either Rule is a raw Traefik rule, or the
+// rule is built from the hosts, path prefix and headers, all of which must match.
+// Priority breaks ties between overlapping routes, the highest winning.
+type Route struct {
+	Hosts      []string
+	PathPrefix string
+	Headers    map[string]string
+	Rule       string
+	Priority   int
+}
+
+var ErrRouteIsInvalid = errors.New("route is invalid")
+
+// Validate checks that the route matches some requests and can be written as a rule.
+func (r Route) Validate() error {
+	matchers := len(r.Hosts) > 0 || r.PathPrefix != "" || len(r.Headers) > 0
+	if r.Rule == "" && !matchers {
+		return ErrRouteIsInvalid
+	}
+
+	if r.Rule != "" && matchers {
+		return ErrRouteIsInvalid
+	}
+
+	for _, host := range r.Hosts {
+		if host == "" || strings.ContainsAny(host, "` /") {
+			return ErrRouteIsInvalid
+		}
+	}
+
+	if r.PathPrefix != "" && (r.PathPrefix[0] != '/' || strings.Contains(r.PathPrefix, "`")) {
+		return ErrRouteIsInvalid
+	}
+
+	for name, value := range r.Headers {
+		if name == "" || strings.Contains(name, "`") || strings.Contains(value, "`") {
+			return ErrRouteIsInvalid
+		}
+	}
+
+	if r.Priority < 0 {
+		return ErrRouteIsInvalid
+	}
+
+	return nil
+}
+
+// Matcher returns the Traefik rule of the route.
+func (r Route) Matcher() string {
+	if r.Rule != "" {
+		return r.Rule
+	}
+
+	var parts []string
+	if len(r.Hosts) > 0 {
+		hosts := make([]string, len(r.Hosts))
+		for i, host := range r.Hosts {
+			hosts[i] = fmt.Sprintf("Host(`%s`)", host)
+		}
+
+		if len(hosts) == 1 {
+			parts = append(parts, hosts[0])
+		} else {
+			parts = append(parts, "("+strings.Join(hosts, " || ")+")")
+		}
+	}
+
+	if r.PathPrefix != "" {
+		parts = append(parts, fmt.Sprintf("PathPrefix(`%s`)", r.PathPrefix))
+	}
+
+	names := make([]string, 0, len(r.Headers))
+	for name := range r.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("Header(`%s`, `%s`)", name, r.Headers[name]))
+	}
+
+	return strings.Join(parts, " && ")
+}
+
+// ValidateRoutes checks the hostname and the routes of a service.
+func ValidateRoutes(hostname string, routes []Route) error {
+	if strings.ContainsAny(hostname, "` /") {
+		return ErrRouteIsInvalid
+	}
+
+	for _, route := range routes {
+		if err := route.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ServiceRoutes returns the routes of a service. Without any route the service is
+// reached on its hostname, or on <service>.local when it has none either.
+func ServiceRoutes(serviceName, hostname string, routes []Route) []Route {
+	if len(routes) > 0 {
+		return routes
+	}
+
+	if hostname == "" {
+		hostname = serviceName + ".local"
+	}
+
+	return []Route{{Hosts: []string{hostname}}}
+}
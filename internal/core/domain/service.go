@@ -1,18 +1,76 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
 
 type (
 	Service struct {
-		ID          string
-		Application string
-		Name        string
-		Version     string
-		Image       string
-		Replicas    int
-		Envs        string
-		Weight      int
-		Hostname    string
-		CreatedAt   time.Time
+		ID                string
+		Application       string
+		Name              string
+		Version           string
+		Image             string
+		Replicas          int
+		Envs              string
+		Weight            int
+		Hostname          string
+		Strategy          string
+		HealthCheck       HealthCheck
+		DockerHealthCheck DockerHealthCheck
+		Routes            []Route
+		TLS               TLS
+		Middlewares       Middlewares
+		CreatedAt         time.Time
 	}
 )
+
+var (
+	ErrServiceStrategyIsInvalid = errors.New("service strategy is invalid")
+	ErrReplicasIsInvalid        = errors.New("replicas must be at least 1")
+)
+
+var deployStrategies = map[string]bool{
+	StrategyBlueGreen:     true,
+	StrategyRollingUpdate: true,
+	StrategyCanary:        true,
+	StrategyAllIn:         true,
+}
+
+var revisionSuffix = regexp.MustCompile(`^(.*)-r(\d+)$`)
+
+// ServiceStrategy validates the strategy used to redeploy a service, defaulting to blue/green.
+func ServiceStrategy(strategy string) (string, error) {
+	if strategy == "" {
+		return StrategyBlueGreen, nil
+	}
+
+	if !deployStrategies[strategy] {
+		return "", ErrServiceStrategyIsInvalid
+	}
+
+	return strategy, nil
+}
+
+// ValidateReplicas rejects a service that would run no container.
+func ValidateReplicas(replicas int) error {
+	if replicas < 1 {
+		return ErrReplicasIsInvalid
+	}
+	return nil
+}
+
+// NextRevision returns the slot used to redeploy a service without changing its version,
+// e.g. v1 becomes v1-r1 and v1-r1 becomes v1-r2.
+func NextRevision(version string) string {
+	if match := revisionSuffix.FindStringSubmatch(version); match != nil {
+		revision, _ := strconv.Atoi(match[2])
+		return fmt.Sprintf("%s-r%d", match[1], revision+1)
+	}
+
+	return version + "-r1"
+}
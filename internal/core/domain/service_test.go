@@ -0,0 +1,44 @@
+package domain
+
+import "testing"
+
+func TestNextRevision(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{name: "first revision", version: "v1", want: "v1-r1"},
+		{name: "next revision", version: "v1-r1", want: "v1-r2"},
+		{name: "multi digit revision", version: "v1-r9", want: "v1-r10"},
+		{name: "dashed version", version: "2024-01-r3", want: "2024-01-r4"},
+		{name: "r without digits", version: "v1-rc", want: "v1-rc-r1"},
+		{name: "empty version", version: "", want: "-r1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextRevision(tt.version); got != tt.want {
+				t.Errorf("NextRevision(%q) = %q, want %q", tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateReplicas(t *testing.T) {
+	tests := []struct {
+		replicas int
+		wantErr  bool
+	}{
+		{replicas: -1, wantErr: true},
+		{replicas: 0, wantErr: true},
+		{replicas: 1},
+		{replicas: 10},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateReplicas(tt.replicas); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateReplicas(%d) error = %v, wantErr %v", tt.replicas, err, tt.wantErr)
+		}
+	}
+}
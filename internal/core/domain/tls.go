@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// TLS asks for the routes of a service to be served over HTTPS, with a certificate
+// issued by CertResolver or the one uploaded for the service. RedirectHTTP sends the
+// plain HTTP requests of those routes to HTTPS instead of leaving them unrouted.
+type TLS struct {
+	Enabled      bool
+	CertResolver string
+	RedirectHTTP bool
+}
+
+// Certificate is a PEM encoded certificate chain and its private key.
+type Certificate struct {
+	Cert string
+	Key  string
+}
+
+var (
+	ErrTLSIsInvalid         = errors.New("tls is invalid")
+	ErrCertificateIsInvalid = errors.New("certificate is invalid")
+)
+
+var certResolverName = regexp.MustCompile(`^[A-Za-z0-9_-]*$`)
+
+// Validate checks that the TLS options can be written to the routers.
+func (t TLS) Validate() error {
+	if !t.Enabled && (t.CertResolver != "" || t.RedirectHTTP) {
+		return ErrTLSIsInvalid
+	}
+
+	if !certResolverName.MatchString(t.CertResolver) {
+		return ErrTLSIsInvalid
+	}
+
+	return nil
+}
+
+// Validate checks that the key matches the certificate and both can be parsed.
+func (c Certificate) Validate() error {
+	if _, err := tls.X509KeyPair([]byte(c.Cert), []byte(c.Key)); err != nil {
+		return fmt.Errorf("%w: %v", ErrCertificateIsInvalid, err)
+	}
+	return nil
+}
@@ -4,20 +4,65 @@ import "time"
 
 type (
 	Deployment struct {
-		ID                  string    `json:"id"`
-		Application         string    `json:"application"`
-		DeploymentStrategy  string    `json:"strategy"`
-		ServiceName         string    `json:"service_name"`
-		Version             string    `json:"version"`
-		Image               string    `json:"image"`
-		Replicas            int       `json:"replicas"`
-		SwapInterval        int       `json:"swap_interval"`
-		HealthCheckInterval int       `json:"health_check_interval"`
-		MaxWaitTime         int       `json:"max_wait_time"`
-		Envs                string    `json:"env"`
-		Action              string    `json:"action"`
-		Step                string    `json:"step"`
-		CreatedAt           time.Time `json:"created_at"`
-		UpdatedAt           time.Time `json:"updated_at"`
+		ID                  string            `json:"id"`
+		Application         string            `json:"application"`
+		DeploymentStrategy  string            `json:"strategy"`
+		ServiceName         string            `json:"service_name"`
+		Version             string            `json:"version"`
+		Image               string            `json:"image"`
+		Replicas            int               `json:"replicas"`
+		SwapInterval        int               `json:"swap_interval"`
+		HealthCheckInterval int               `json:"health_check_interval"`
+		MaxWaitTime         int               `json:"max_wait_time"`
+		Envs                string            `json:"env"`
+		Action              string            `json:"action"`
+		Step                string            `json:"step"`
+		BatchSize           int               `json:"batch_size"`
+		MaxUnavailable      int               `json:"max_unavailable"`
+		CanarySteps         []CanaryStep      `json:"canary_steps,omitempty"`
+		CanaryReplicas      int               `json:"canary_replicas"`
+		MaxErrorRate        float64           `json:"max_error_rate"`
+		FailureThreshold    int               `json:"failure_threshold"`
+		Progression         string            `json:"progression,omitempty"`
+		AutoFinishAfter     int               `json:"auto_finish_after,omitempty"`
+		HealthCheck         HealthCheck       `json:"health_check"`
+		DockerHealthCheck   DockerHealthCheck `json:"docker_health_check"`
+		Previous            *ServiceSpec      `json:"previous,omitempty"`
+		Pending             *ServiceSpec      `json:"pending,omitempty"`
+		Steps               []DeploymentStep  `json:"steps,omitempty"`
+		CreatedAt           time.Time         `json:"created_at"`
+		UpdatedAt           time.Time         `json:"updated_at"`
+	}
+
+	DeploymentProgress struct {
+		DeploymentID string    `json:"deployment_id"`
+		Type         string    `json:"type"`
+		Step         string    `json:"step"`
+		Weights      []Weight  `json:"weights,omitempty"`
+		Event        *Event    `json:"event,omitempty"`
+		CreatedAt    time.Time `json:"created_at"`
+	}
+
+	Weight struct {
+		Slot   string `json:"slot"`
+		Weight int    `json:"weight"`
+	}
+
+	DeploymentStep struct {
+		Step      string    `json:"step"`
+		CreatedAt time.Time `json:"created_at"`
+	}
+
+	CanaryStep struct {
+		Weight int `json:"weight"`
+		Bake   int `json:"bake"`
+	}
+
+	// ServiceSpec is what the containers of a slot are started with.
+	ServiceSpec struct {
+		Image             string            `json:"image"`
+		Replicas          int               `json:"replicas"`
+		Envs              string            `json:"env"`
+		DockerHealthCheck DockerHealthCheck `json:"docker_health_check"`
 	}
 )
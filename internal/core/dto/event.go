@@ -0,0 +1,16 @@
+package dto
+
+import "time"
+
+type (
+	Event struct {
+		ID           string                 `json:"id"`
+		Application  string                 `json:"application"`
+		ServiceName  string                 `json:"service_name"`
+		DeploymentID string                 `json:"deployment_id"`
+		Type         string                 `json:"type"`
+		Message      string                 `json:"message"`
+		Details      map[string]interface{} `json:"details,omitempty"`
+		CreatedAt    time.Time              `json:"created_at"`
+	}
+)
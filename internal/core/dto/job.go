@@ -0,0 +1,21 @@
+package dto
+
+import "time"
+
+// DeadLetter is a job that was parked because it could not be run or ran out of deliveries.
+type DeadLetter struct {
+	ID           string    `json:"id"`
+	Stream       string    `json:"stream"`
+	OriginalID   string    `json:"original_id"`
+	DeploymentID string    `json:"deployment_id,omitempty"`
+	Reason       string    `json:"reason"`
+	Deliveries   int       `json:"deliveries"`
+	Payload      string    `json:"payload"`
+	FailedAt     time.Time `json:"failed_at"`
+}
+
+// ControlMessage asks the agents to act on a deployment they are running.
+type ControlMessage struct {
+	Type         string `json:"type"`
+	DeploymentID string `json:"deployment_id"`
+}
@@ -4,15 +4,123 @@ import "time"
 
 type (
 	Service struct {
-		ID          string    `json:"id"`
-		Application string    `json:"application"`
-		Name        string    `json:"name"`
-		Version     string    `json:"version"`
-		Image       string    `json:"image"`
-		Replicas    int       `json:"replicas"`
-		Envs        string    `json:"envs"`
-		Weight      int       `json:"weight"`
-		Hostname    string    `json:"hostname"`
-		CreatedAt   time.Time `json:"created_at"`
+		ID                string            `json:"id"`
+		Application       string            `json:"application"`
+		Name              string            `json:"name"`
+		Version           string            `json:"version"`
+		Image             string            `json:"image"`
+		Replicas          int               `json:"replicas"`
+		Envs              string            `json:"envs"`
+		Weight            int               `json:"weight"`
+		Hostname          string            `json:"hostname"`
+		Strategy          string            `json:"strategy"`
+		HealthCheck       HealthCheck       `json:"health_check"`
+		DockerHealthCheck DockerHealthCheck `json:"docker_health_check"`
+		Routes            []Route           `json:"routes"`
+		TLS               TLS               `json:"tls"`
+		Middlewares       Middlewares       `json:"middlewares"`
+		// Certificate is only handed to the agents, never returned by the API.
+		Certificate    *Certificate `json:"-"`
+		HasCertificate bool         `json:"has_certificate"`
+		CreatedAt      time.Time    `json:"created_at"`
+	}
+
+	// HealthCheck describes how the instances of a service are probed. Zero fields use
+	// the defaults: an HTTP GET /ping answering 200.
+	HealthCheck struct {
+		Type             string            `json:"type,omitempty"`
+		Path             string            `json:"path,omitempty"`
+		Method           string            `json:"method,omitempty"`
+		Headers          map[string]string `json:"headers,omitempty"`
+		ExpectedStatus   []int             `json:"expected_status,omitempty"`
+		BodyContains     string            `json:"body_contains,omitempty"`
+		BodyJSONPath     string            `json:"body_json_path,omitempty"`
+		BodyJSONValue    string            `json:"body_json_value,omitempty"`
+		TimeoutSeconds   int               `json:"timeout_seconds,omitempty"`
+		SuccessThreshold int               `json:"success_threshold,omitempty"`
+		FailureThreshold int               `json:"failure_threshold,omitempty"`
+		Command          []string          `json:"command,omitempty"`
+		GRPCService      string            `json:"grpc_service,omitempty"`
+		QuorumPercent    int               `json:"quorum_percent,omitempty"`
+	}
+
+	// DockerHealthCheck is the HEALTHCHECK Docker runs inside the containers. Without a
+	// test the containers keep the one of their image, and Disable turns it off.
+	DockerHealthCheck struct {
+		Test               []string `json:"test,omitempty"`
+		IntervalSeconds    int      `json:"interval_seconds,omitempty"`
+		TimeoutSeconds     int      `json:"timeout_seconds,omitempty"`
+		StartPeriodSeconds int      `json:"start_period_seconds,omitempty"`
+		Retries            int      `json:"retries,omitempty"`
+		Disable            bool     `json:"disable,omitempty"`
+	}
+
+	// Route is one way requests reach a service: a raw Traefik rule, or the hosts, path
+	// prefix and headers that must all match.
+	Route struct {
+		Hosts      []string          `json:"hosts,omitempty"`
+		PathPrefix string            `json:"path_prefix,omitempty"`
+		Headers    map[string]string `json:"headers,omitempty"`
+		Rule       string            `json:"rule,omitempty"`
+		Priority   int               `json:"priority,omitempty"`
+	}
+
+	// TLS asks for the routes of a service to be served over HTTPS, with a certificate
+	// issued by CertResolver or the one uploaded for the service.
+	TLS struct {
+		Enabled      bool   `json:"enabled"`
+		CertResolver string `json:"cert_resolver,omitempty"`
+		RedirectHTTP bool   `json:"redirect_http,omitempty"`
+	}
+
+	// Certificate is a PEM encoded certificate chain and its private key.
+	Certificate struct {
+		Cert string `json:"cert"`
+		Key  string `json:"key"`
+	}
+
+	// Middlewares are the protections and rewrites Traefik applies to the requests of a
+	// service before they reach it. A missing field leaves that middleware out.
+	Middlewares struct {
+		RateLimit      *RateLimit `json:"rate_limit,omitempty"`
+		Headers        *Headers   `json:"headers,omitempty"`
+		BasicAuth      *BasicAuth `json:"basic_auth,omitempty"`
+		Retry          *Retry     `json:"retry,omitempty"`
+		Compress       bool       `json:"compress,omitempty"`
+		StripPrefix    []string   `json:"strip_prefix,omitempty"`
+		IPAllowList    []string   `json:"ip_allow_list,omitempty"`
+		CircuitBreaker string     `json:"circuit_breaker,omitempty"`
+	}
+
+	RateLimit struct {
+		Average       int `json:"average"`
+		Burst         int `json:"burst,omitempty"`
+		PeriodSeconds int `json:"period_seconds,omitempty"`
+	}
+
+	Headers struct {
+		CustomRequestHeaders          map[string]string `json:"custom_request_headers,omitempty"`
+		CustomResponseHeaders         map[string]string `json:"custom_response_headers,omitempty"`
+		AccessControlAllowOrigins     []string          `json:"access_control_allow_origins,omitempty"`
+		AccessControlAllowMethods     []string          `json:"access_control_allow_methods,omitempty"`
+		AccessControlAllowHeaders     []string          `json:"access_control_allow_headers,omitempty"`
+		AccessControlAllowCredentials bool              `json:"access_control_allow_credentials,omitempty"`
+		AccessControlMaxAge           int               `json:"access_control_max_age,omitempty"`
+		STSSeconds                    int               `json:"sts_seconds,omitempty"`
+		FrameDeny                     bool              `json:"frame_deny,omitempty"`
+		ContentTypeNosniff            bool              `json:"content_type_nosniff,omitempty"`
+		BrowserXSSFilter              bool              `json:"browser_xss_filter,omitempty"`
+		ReferrerPolicy                string            `json:"referrer_policy,omitempty"`
+	}
+
+	// BasicAuth lets in the users given as htpasswd lines.
+	BasicAuth struct {
+		Users []string `json:"users"`
+		Realm string   `json:"realm,omitempty"`
+	}
+
+	Retry struct {
+		Attempts          int `json:"attempts"`
+		InitialIntervalMs int `json:"initial_interval_ms,omitempty"`
 	}
 )
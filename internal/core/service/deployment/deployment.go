@@ -3,43 +3,103 @@ package deployment
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/elissonalvesilva/releasy/internal/convert"
 	"github.com/elissonalvesilva/releasy/internal/core/domain"
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
 	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/google/uuid"
 	"time"
 )
 
 type (
 	DeploymentCommand struct {
-		DeploymentStrategy  string   `json:"strategy"`
-		Application         string   `json:"application"`
-		ServiceName         string   `json:"service_name"`
-		Replicas            int      `json:"replicas"`
-		Image               string   `json:"image"`
-		SwapInterval        int      `json:"swap_interval,omitempty"`
-		HealthCheckInterval int      `json:"health_check_interval,omitempty"`
-		Envs                []string `json:"envs,omitempty"`
-		MaxWaitTime         int      `json:"max_wait_time,omitempty"`
-		Version             string   `json:"version"`
-		Action              string   `json:"action,omitempty"`
+		DeploymentStrategy  string           `json:"strategy"`
+		Application         string           `json:"application"`
+		ServiceName         string           `json:"service_name"`
+		Replicas            int              `json:"replicas"`
+		Image               string           `json:"image"`
+		SwapInterval        int              `json:"swap_interval,omitempty"`
+		HealthCheckInterval int              `json:"health_check_interval,omitempty"`
+		Envs                []string         `json:"envs,omitempty"`
+		MaxWaitTime         int              `json:"max_wait_time,omitempty"`
+		Version             string           `json:"version"`
+		Action              string           `json:"action,omitempty"`
+		BatchSize           int              `json:"batch_size,omitempty"`
+		MaxUnavailable      int              `json:"max_unavailable,omitempty"`
+		CanarySteps         []dto.CanaryStep `json:"canary_steps,omitempty"`
+		CanaryReplicas      int              `json:"canary_replicas,omitempty"`
+		MaxErrorRate        float64          `json:"max_error_rate,omitempty"`
+		FailureThreshold    int              `json:"failure_threshold,omitempty"`
+		Progression         string           `json:"progression,omitempty"`
+		AutoFinishAfter     int              `json:"auto_finish_after,omitempty"`
+		HealthCheck         *dto.HealthCheck `json:"health_check,omitempty"`
+		// Previous is the spec of the serving slot, taken from the service when nil.
+		Previous *dto.ServiceSpec `json:"-"`
+		// Pending is the spec a redeploy records on the service once it finished.
+		Pending *dto.ServiceSpec `json:"-"`
+	}
+
+	ListDeploymentsQuery struct {
+		Application string
+		ServiceName string
+		Strategy    string
+		Step        string
+		Version     string
+		Page        int
+		PerPage     int
 	}
 
 	Deployment interface {
 		Execute(ctx context.Context, command DeploymentCommand) (string, error)
 		Finish(ctx context.Context, jobId string) error
+		Rollback(ctx context.Context, jobId string) error
+		Get(ctx context.Context, id string) (*dto.Deployment, error)
+		List(ctx context.Context, query ListDeploymentsQuery) ([]dto.Deployment, int, error)
+		Watch(ctx context.Context, id string) (<-chan dto.DeploymentProgress, func() error, error)
+		Events(ctx context.Context, id string) ([]dto.Event, error)
+		ServiceEvents(ctx context.Context, application, serviceName string, limit int) ([]dto.Event, error)
+		EnsureIdle(ctx context.Context, application, serviceName string) error
+		Cancel(ctx context.Context, id string) error
+		Promote(ctx context.Context, id string) error
+		Pause(ctx context.Context, id string) error
+		Resume(ctx context.Context, id string) error
+		SweepEffective(ctx context.Context, maxAge time.Duration, finish bool) error
 	}
 
 	DeploymentService struct {
 		StreamsStore store.Streams
 		db           store.DbStore
+		jobStreams   store.JobStreams
 	}
 )
 
-func NewDeploymentService(streams store.Streams, db store.DbStore) *DeploymentService {
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+
+	DefaultEventsLimit = 100
+	MaxEventsLimit     = 1000
+)
+
+// WithDefaults bounds the pagination of the query.
+func (q ListDeploymentsQuery) WithDefaults() ListDeploymentsQuery {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PerPage < 1 || q.PerPage > MaxPerPage {
+		q.PerPage = DefaultPerPage
+	}
+	return q
+}
+
+func NewDeploymentService(streams store.Streams, db store.DbStore, jobStreams store.JobStreams) *DeploymentService {
 	return &DeploymentService{
 		StreamsStore: streams,
 		db:           db,
+		jobStreams:   jobStreams,
 	}
 }
 
@@ -53,6 +113,10 @@ func (d *DeploymentService) Execute(ctx context.Context, command DeploymentComma
 		command.Action = domain.ActionDeployCreate
 	}
 
+	if err := d.EnsureIdle(ctx, command.Application, command.ServiceName); err != nil {
+		return "", err
+	}
+
 	deployment, err := domain.NewDeployment(
 		command.DeploymentStrategy,
 		command.Action,
@@ -71,6 +135,58 @@ func (d *DeploymentService) Execute(ctx context.Context, command DeploymentComma
 		return "", err
 	}
 
+	if err := deployment.SetRollingUpdate(command.BatchSize, command.MaxUnavailable); err != nil {
+		return "", err
+	}
+
+	if err := deployment.SetAnalysis(command.MaxErrorRate, command.FailureThreshold); err != nil {
+		return "", err
+	}
+
+	if deployment.DeploymentStrategy == domain.StrategyCanary {
+		if err := deployment.SetCanary(toDomainCanarySteps(command.CanarySteps), command.CanaryReplicas); err != nil {
+			return "", err
+		}
+	}
+
+	if err := deployment.SetProgression(command.Progression); err != nil {
+		return "", err
+	}
+
+	if err := deployment.SetAutoFinish(command.AutoFinishAfter); err != nil {
+		return "", err
+	}
+
+	healthCheck := convert.ToDomainHealthCheck(service.HealthCheck)
+	if command.HealthCheck != nil {
+		healthCheck = healthCheck.Override(convert.ToDomainHealthCheck(*command.HealthCheck))
+	}
+
+	if err := deployment.SetHealthCheck(healthCheck); err != nil {
+		return "", err
+	}
+
+	dockerHealthCheck := service.DockerHealthCheck
+	if command.Pending != nil {
+		dockerHealthCheck = command.Pending.DockerHealthCheck
+	}
+
+	if err := deployment.SetDockerHealthCheck(convert.ToDomainDockerHealthCheck(dockerHealthCheck)); err != nil {
+		return "", err
+	}
+
+	previous := command.Previous
+	if previous == nil {
+		previous = &dto.ServiceSpec{
+			Image:             service.Image,
+			Replicas:          service.Replicas,
+			Envs:              service.Envs,
+			DockerHealthCheck: service.DockerHealthCheck,
+		}
+	}
+	deployment.Previous = toDomainServiceSpec(previous)
+	deployment.Pending = toDomainServiceSpec(command.Pending)
+
 	deploymentJSON, err := d.toDeploymentStreamData(*deployment)
 	if err != nil {
 		return "", err
@@ -83,10 +199,14 @@ func (d *DeploymentService) Execute(ctx context.Context, command DeploymentComma
 
 	dtoDeployment := d.toDTODeployment(*deployment)
 	if err := d.db.SaveDeployment(ctx, dtoDeployment); err != nil {
+		if errors.Is(err, store.ErrActiveDeployment) {
+			// Another request got its deployment in since EnsureIdle.
+			return "", fmt.Errorf("%w: %s", domain.ErrDeploymentInProgress, err)
+		}
 		return "", err
 	}
 
-	if err := d.StreamsStore.PublishJob("releasy_jobs", payload); err != nil {
+	if err := d.StreamsStore.PublishJob(d.jobStreams.For(deployment.Application), payload); err != nil {
 		return "", err
 	}
 
@@ -100,29 +220,352 @@ func (d *DeploymentService) Finish(ctx context.Context, jobId string) error {
 	}
 
 	if deployment.Step != domain.StepEffective {
-		return fmt.Errorf("deployment is not effective")
+		return domain.ErrDeploymentNotEffective
+	}
+
+	return d.finish(ctx, deployment)
+}
+
+func (d *DeploymentService) Rollback(ctx context.Context, jobId string) error {
+	deployment, err := d.db.GetDeploymentByID(ctx, jobId)
+	if err != nil {
+		return err
+	}
+
+	if deployment.Strategy != domain.StrategyBlueGreen {
+		return domain.ErrRollbackNotSupported
+	}
+
+	if deployment.Step != domain.StepEffective {
+		return domain.ErrDeploymentNotEffective
+	}
+
+	return d.publishAction(deployment, domain.ActionDeployRollback)
+}
+
+func (d *DeploymentService) Get(ctx context.Context, id string) (*dto.Deployment, error) {
+	deployment, err := d.db.GetDeploymentByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	deployment.Action = domain.ActionDeployFinish
+	steps, err := d.db.GetDeploymentSteps(ctx, deployment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := toDTOFromStore(*deployment, steps)
+	return &out, nil
+}
+
+func (d *DeploymentService) List(ctx context.Context, query ListDeploymentsQuery) ([]dto.Deployment, int, error) {
+	query = query.WithDefaults()
+
+	deployments, total, err := d.db.ListDeployments(ctx, store.DeploymentFilter{
+		Application: query.Application,
+		ServiceName: query.ServiceName,
+		Strategy:    query.Strategy,
+		Step:        query.Step,
+		Version:     query.Version,
+		Limit:       query.PerPage,
+		Offset:      (query.Page - 1) * query.PerPage,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]string, 0, len(deployments))
+	for _, deployment := range deployments {
+		ids = append(ids, deployment.ID)
+	}
+
+	steps, err := d.db.GetDeploymentSteps(ctx, ids...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	out := make([]dto.Deployment, 0, len(deployments))
+	for _, deployment := range deployments {
+		out = append(out, toDTOFromStore(deployment, steps))
+	}
+
+	return out, total, nil
+}
+
+// Watch follows the progress events the agent publishes for a deployment. The returned
+// channel is closed when the subscription is closed or ctx is done.
+func (d *DeploymentService) Watch(ctx context.Context, id string) (<-chan dto.DeploymentProgress, func() error, error) {
+	messages, closeFn, err := d.StreamsStore.Subscribe(ctx, store.DeploymentChannel(id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan dto.DeploymentProgress)
+	go func() {
+		defer close(events)
+		for msg := range messages {
+			var event dto.DeploymentProgress
+			if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+				logger.WithError(err).Warn("invalid deployment progress event")
+				continue
+			}
 
-	job := map[string]interface{}{
-		"id":           deployment.ID,
-		"service_name": deployment.ServiceName,
-		"strategy":     deployment.Strategy,
-		"image":        deployment.Image,
-		"action":       deployment.Action,
-		"version":      deployment.Version,
-		"created_at":   time.Now().Format(time.RFC3339),
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return events, closeFn, nil
+}
+
+// Cancel stops a deployment that has not become effective yet. The agent running it
+// restores the stable slot and removes the candidate; a job still waiting in the stream
+// is skipped.
+func (d *DeploymentService) Cancel(ctx context.Context, id string) error {
+	deployment, err := d.db.GetDeploymentByID(ctx, id)
+	if err != nil {
+		return err
 	}
 
+	if err := ensureShifting(deployment); err != nil {
+		return err
+	}
+
+	if deployment.Step == domain.StepCreating {
+		if err := d.db.UpdateDeploymentStep(ctx, id, domain.StepCancelled); err != nil {
+			return err
+		}
+	}
+
+	return d.publishControl(domain.ControlCancel, id)
+}
+
+// Promote lets a held deployment take its next traffic step. A blue/green deployment
+// that is already effective is finished.
+func (d *DeploymentService) Promote(ctx context.Context, id string) error {
+	deployment, err := d.db.GetDeploymentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if deployment.Step == domain.StepEffective && deployment.Strategy == domain.StrategyBlueGreen {
+		return d.finish(ctx, deployment)
+	}
+
+	if err := ensureShifting(deployment); err != nil {
+		return err
+	}
+
+	return d.publishControl(domain.ControlPromote, id)
+}
+
+// Pause holds a deployment at its next traffic step until it is promoted or resumed.
+func (d *DeploymentService) Pause(ctx context.Context, id string) error {
+	deployment, err := d.db.GetDeploymentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureShifting(deployment); err != nil {
+		return err
+	}
+
+	return d.publishControl(domain.ControlPause, id)
+}
+
+// Resume lets a paused or manual deployment take its following traffic steps without
+// waiting.
+func (d *DeploymentService) Resume(ctx context.Context, id string) error {
+	deployment, err := d.db.GetDeploymentByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err := ensureShifting(deployment); err != nil {
+		return err
+	}
+
+	return d.publishControl(domain.ControlResume, id)
+}
+
+// SweepEffective finds the deployments left effective for longer than maxAge, on top of
+// the bake time they were given, and either finishes them or flags them once with an
+// effective_overdue event.
+func (d *DeploymentService) SweepEffective(ctx context.Context, maxAge time.Duration, finish bool) error {
+	deployments, err := d.db.ListStaleDeployments(ctx, domain.StepEffective, time.Now().Add(-maxAge))
+	if err != nil {
+		return err
+	}
+
+	for i := range deployments {
+		deployment := &deployments[i]
+
+		var job dto.Deployment
+		if deployment.Payload != "" {
+			if err := json.Unmarshal([]byte(deployment.Payload), &job); err != nil {
+				logger.WithError(err).Warn(fmt.Sprintf("invalid payload on deployment %s", deployment.ID))
+			}
+		}
+
+		bake := time.Duration(job.AutoFinishAfter) * time.Second
+		effectiveFor := time.Since(deployment.UpdatedAt)
+		if effectiveFor < maxAge+bake {
+			continue
+		}
+
+		if finish {
+			logger.Info(fmt.Sprintf("finishing deployment %s, effective for %s", deployment.ID, effectiveFor.Round(time.Second)))
+			if err := d.finish(ctx, deployment); err != nil {
+				logger.WithError(err).Error(fmt.Sprintf("failed to finish deployment %s", deployment.ID))
+			}
+			continue
+		}
+
+		if err := d.flagOverdue(ctx, deployment, effectiveFor); err != nil {
+			logger.WithError(err).Error(fmt.Sprintf("failed to flag deployment %s", deployment.ID))
+		}
+	}
+
+	return nil
+}
+
+// finish marks an effective deployment as finishing before publishing its finish job,
+// so that it is not finished a second time while the job waits in the stream.
+func (d *DeploymentService) finish(ctx context.Context, deployment *store.Deployment) error {
+	if err := d.db.UpdateDeploymentStep(ctx, deployment.ID, domain.StepFinishing); err != nil {
+		return err
+	}
+
+	if err := d.publishAction(deployment, domain.ActionDeployFinish); err != nil {
+		if restoreErr := d.db.UpdateDeploymentStep(ctx, deployment.ID, domain.StepEffective); restoreErr != nil {
+			logger.WithError(restoreErr).Error(fmt.Sprintf("failed to restore deployment %s as effective", deployment.ID))
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (d *DeploymentService) flagOverdue(ctx context.Context, deployment *store.Deployment, effectiveFor time.Duration) error {
+	events, err := d.db.GetDeploymentEvents(ctx, deployment.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if event.Type == domain.EventEffectiveOverdue {
+			return nil
+		}
+	}
+
+	logger.Warn(fmt.Sprintf("deployment %s of %s has been effective for %s", deployment.ID, deployment.ServiceName, effectiveFor.Round(time.Second)))
+	return d.db.SaveEvent(ctx, store.Event{
+		ID:           uuid.NewString(),
+		Application:  deployment.Application,
+		ServiceName:  deployment.ServiceName,
+		DeploymentID: deployment.ID,
+		Type:         domain.EventEffectiveOverdue,
+		Message:      fmt.Sprintf("deployment has been effective for %s without being finished", effectiveFor.Round(time.Second)),
+		Details:      fmt.Sprintf(`{"effective_seconds": %d}`, int(effectiveFor.Seconds())),
+		CreatedAt:    time.Now(),
+	})
+}
+
+// ensureShifting fails with ErrDeploymentNotInFlight once a deployment has no traffic
+// step left to hold.
+func ensureShifting(deployment *store.Deployment) error {
+	if domain.IsTerminalStep(deployment.Step) || deployment.Step == domain.StepEffective {
+		return fmt.Errorf("%w: %s is %s", domain.ErrDeploymentNotInFlight, deployment.ID, deployment.Step)
+	}
+	return nil
+}
+
+func (d *DeploymentService) publishControl(controlType, id string) error {
+	message, err := json.Marshal(dto.ControlMessage{Type: controlType, DeploymentID: id})
+	if err != nil {
+		return err
+	}
+
+	return d.StreamsStore.Publish(store.ControlChannel, string(message))
+}
+
+// EnsureIdle fails with ErrDeploymentInProgress while a deployment of the service has
+// not reached a terminal step.
+func (d *DeploymentService) EnsureIdle(ctx context.Context, application, serviceName string) error {
+	active, err := d.db.GetActiveDeployment(ctx, application, serviceName, domain.TerminalSteps)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s is %s", domain.ErrDeploymentInProgress, active.ID, active.Step)
+}
+
+// Events returns the timeline of a deployment, oldest event first.
+func (d *DeploymentService) Events(ctx context.Context, id string) ([]dto.Event, error) {
+	if _, err := d.db.GetDeploymentByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	events, err := d.db.GetDeploymentEvents(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toDTOEvents(events), nil
+}
+
+// ServiceEvents returns the latest events of every deployment of a service, newest event first.
+func (d *DeploymentService) ServiceEvents(ctx context.Context, application, serviceName string, limit int) ([]dto.Event, error) {
+	if limit < 1 || limit > MaxEventsLimit {
+		limit = DefaultEventsLimit
+	}
+
+	events, err := d.db.GetEvents(ctx, application, serviceName, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return toDTOEvents(events), nil
+}
+
+// publishAction publishes the stored job of a deployment again with another action, so
+// that its envs, replicas and health checks are kept for the agent to resume from.
+func (d *DeploymentService) publishAction(deployment *store.Deployment, action string) error {
+	deployment.Action = action
+
+	job := map[string]interface{}{}
+	if deployment.Payload != "" {
+		if err := json.Unmarshal([]byte(deployment.Payload), &job); err != nil {
+			return fmt.Errorf("invalid payload on deployment %s: %w", deployment.ID, err)
+		}
+	}
+
+	job["id"] = deployment.ID
+	job["application"] = deployment.Application
+	job["service_name"] = deployment.ServiceName
+	job["strategy"] = deployment.Strategy
+	job["image"] = deployment.Image
+	job["action"] = deployment.Action
+	job["version"] = deployment.Version
+	job["created_at"] = time.Now().Format(time.RFC3339)
+
 	deploymentJSON, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
 
 	payload := map[string]interface{}{
 		"payload":    string(deploymentJSON),
 		"created_at": time.Now().Format(time.RFC3339),
 	}
 
-	if err := d.StreamsStore.PublishJob("releasy_jobs", payload); err != nil {
+	if err := d.StreamsStore.PublishJob(d.jobStreams.For(deployment.Application), payload); err != nil {
 		return err
 	}
 
@@ -143,6 +586,18 @@ func (d *DeploymentService) toDTODeployment(deployment domain.Deployment) dto.De
 		MaxWaitTime:        deployment.MaxWaitTime,
 		Action:             deployment.Action,
 		Step:               deployment.Step,
+		BatchSize:          deployment.BatchSize,
+		MaxUnavailable:     deployment.MaxUnavailable,
+		CanarySteps:        toDTOCanarySteps(deployment.CanarySteps),
+		CanaryReplicas:     deployment.CanaryReplicas,
+		MaxErrorRate:       deployment.MaxErrorRate,
+		FailureThreshold:   deployment.FailureThreshold,
+		Progression:        deployment.Progression,
+		AutoFinishAfter:    deployment.AutoFinishAfter,
+		HealthCheck:        convert.ToDTOHealthCheck(deployment.HealthCheck),
+		DockerHealthCheck:  convert.ToDTODockerHealthCheck(deployment.DockerHealthCheck),
+		Previous:           toDTOServiceSpec(deployment.Previous),
+		Pending:            toDTOServiceSpec(deployment.Pending),
 		CreatedAt:          deployment.CreatedAt,
 	}
 }
@@ -161,6 +616,18 @@ func (d *DeploymentService) toDeploymentStreamData(deployment domain.Deployment)
 		"max_wait_time":         deployment.MaxWaitTime,
 		"env":                   deployment.Envs,
 		"action":                deployment.Action,
+		"batch_size":            deployment.BatchSize,
+		"max_unavailable":       deployment.MaxUnavailable,
+		"canary_steps":          toDTOCanarySteps(deployment.CanarySteps),
+		"canary_replicas":       deployment.CanaryReplicas,
+		"max_error_rate":        deployment.MaxErrorRate,
+		"failure_threshold":     deployment.FailureThreshold,
+		"progression":           deployment.Progression,
+		"auto_finish_after":     deployment.AutoFinishAfter,
+		"health_check":          convert.ToDTOHealthCheck(deployment.HealthCheck),
+		"docker_health_check":   convert.ToDTODockerHealthCheck(deployment.DockerHealthCheck),
+		"previous":              toDTOServiceSpec(deployment.Previous),
+		"pending":               toDTOServiceSpec(deployment.Pending),
 		"created_at":            deployment.CreatedAt,
 	}
 
@@ -172,6 +639,95 @@ func (d *DeploymentService) toDeploymentStreamData(deployment domain.Deployment)
 	return deploymentJSON, nil
 }
 
+func toDTOFromStore(deployment store.Deployment, steps []store.DeploymentStep) dto.Deployment {
+	out := dto.Deployment{
+		ID:                 deployment.ID,
+		Application:        deployment.Application,
+		DeploymentStrategy: deployment.Strategy,
+		ServiceName:        deployment.ServiceName,
+		Version:            deployment.Version,
+		Image:              deployment.Image,
+		Replicas:           deployment.Replicas,
+		Envs:               deployment.Envs,
+		Action:             deployment.Action,
+		Step:               deployment.Step,
+		CreatedAt:          deployment.CreatedAt,
+		UpdatedAt:          deployment.UpdatedAt,
+	}
+
+	for _, step := range steps {
+		if step.DeploymentID == deployment.ID {
+			out.Steps = append(out.Steps, dto.DeploymentStep{Step: step.Step, CreatedAt: step.CreatedAt})
+		}
+	}
+
+	return out
+}
+
+func toDTOEvents(events []store.Event) []dto.Event {
+	out := make([]dto.Event, 0, len(events))
+	for _, event := range events {
+		var details map[string]interface{}
+		if event.Details != "" {
+			if err := json.Unmarshal([]byte(event.Details), &details); err != nil {
+				logger.WithError(err).Warn(fmt.Sprintf("invalid details on event %s", event.ID))
+			}
+		}
+
+		out = append(out, dto.Event{
+			ID:           event.ID,
+			Application:  event.Application,
+			ServiceName:  event.ServiceName,
+			DeploymentID: event.DeploymentID,
+			Type:         event.Type,
+			Message:      event.Message,
+			Details:      details,
+			CreatedAt:    event.CreatedAt,
+		})
+	}
+	return out
+}
+
+func toDomainCanarySteps(steps []dto.CanaryStep) []domain.CanaryStep {
+	var out []domain.CanaryStep
+	for _, step := range steps {
+		out = append(out, domain.CanaryStep{Weight: step.Weight, Bake: step.Bake})
+	}
+	return out
+}
+
+func toDTOCanarySteps(steps []domain.CanaryStep) []dto.CanaryStep {
+	var out []dto.CanaryStep
+	for _, step := range steps {
+		out = append(out, dto.CanaryStep{Weight: step.Weight, Bake: step.Bake})
+	}
+	return out
+}
+
+func toDomainServiceSpec(s *dto.ServiceSpec) *domain.ServiceSpec {
+	if s == nil {
+		return nil
+	}
+	return &domain.ServiceSpec{
+		Image:             s.Image,
+		Replicas:          s.Replicas,
+		Envs:              s.Envs,
+		DockerHealthCheck: convert.ToDomainDockerHealthCheck(s.DockerHealthCheck),
+	}
+}
+
+func toDTOServiceSpec(s *domain.ServiceSpec) *dto.ServiceSpec {
+	if s == nil {
+		return nil
+	}
+	return &dto.ServiceSpec{
+		Image:             s.Image,
+		Replicas:          s.Replicas,
+		Envs:              s.Envs,
+		DockerHealthCheck: convert.ToDTODockerHealthCheck(s.DockerHealthCheck),
+	}
+}
+
 func (d *DeploymentService) getService(ctx context.Context, application, serviceName string) (*dto.Service, error) {
 	return d.db.GetService(ctx, application, serviceName)
 }
@@ -0,0 +1,169 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	DefaultDeadLettersLimit = 50
+	MaxDeadLettersLimit     = 500
+)
+
+type (
+	JobUsecase interface {
+		ListDeadLetters(stream string, limit int) ([]dto.DeadLetter, error)
+		Requeue(ctx context.Context, stream, id string) (string, error)
+	}
+
+	JobService struct {
+		StreamsStore store.Streams
+		db           store.DbStore
+		jobStreams   store.JobStreams
+	}
+)
+
+var ErrUnknownStream = errors.New("unknown job stream")
+
+func NewJobService(streams store.Streams, db store.DbStore, jobStreams store.JobStreams) *JobService {
+	return &JobService{
+		StreamsStore: streams,
+		db:           db,
+		jobStreams:   jobStreams,
+	}
+}
+
+// ListDeadLetters returns the latest parked jobs of stream, or of every job stream
+// when stream is empty, newest first.
+func (j *JobService) ListDeadLetters(stream string, limit int) ([]dto.DeadLetter, error) {
+	if limit < 1 || limit > MaxDeadLettersLimit {
+		limit = DefaultDeadLettersLimit
+	}
+
+	streams := j.jobStreams.All()
+	if stream != "" {
+		if !j.known(stream) {
+			return nil, ErrUnknownStream
+		}
+		streams = []string{stream}
+	}
+
+	var out []dto.DeadLetter
+	for _, stream := range streams {
+		messages, err := j.StreamsStore.ListDeadLetters(stream, int64(limit))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range messages {
+			out = append(out, toDeadLetter(stream, msg))
+		}
+	}
+
+	sort.Slice(out, func(a, b int) bool { return out[a].FailedAt.After(out[b].FailedAt) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Requeue publishes a parked job of stream again and returns the id of its new stream
+// entry. A deployment that had failed is started over, as agents skip finished ones,
+// unless another deployment of its service is in progress.
+func (j *JobService) Requeue(ctx context.Context, stream, id string) (string, error) {
+	if stream == "" {
+		stream = j.jobStreams.Default
+	}
+	if !j.known(stream) {
+		return "", ErrUnknownStream
+	}
+
+	msg, err := j.StreamsStore.GetDeadLetter(stream, id)
+	if err != nil {
+		return "", fmt.Errorf("requeue %s: %w", id, err)
+	}
+
+	if deploymentID := toDeadLetter(stream, *msg).DeploymentID; deploymentID != "" {
+		deployment, err := j.db.GetDeploymentByID(ctx, deploymentID)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return "", err
+		}
+		if err == nil && domain.IsTerminalStep(deployment.Step) {
+			if err := j.ensureIdle(ctx, deployment.Application, deployment.ServiceName); err != nil {
+				return "", err
+			}
+			if err := j.db.UpdateDeploymentStep(ctx, deploymentID, domain.StepCreating); err != nil {
+				if errors.Is(err, store.ErrActiveDeployment) {
+					return "", fmt.Errorf("%w: %s", domain.ErrDeploymentInProgress, err)
+				}
+				return "", err
+			}
+		}
+	}
+
+	newID, err := j.StreamsStore.RequeueDeadLetter(stream, id)
+	if err != nil {
+		return "", fmt.Errorf("requeue %s: %w", id, err)
+	}
+	return newID, nil
+}
+
+// ensureIdle fails with ErrDeploymentInProgress while a deployment of the service has
+// not reached a terminal step.
+func (j *JobService) ensureIdle(ctx context.Context, application, serviceName string) error {
+	active, err := j.db.GetActiveDeployment(ctx, application, serviceName, domain.TerminalSteps)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %s is %s", domain.ErrDeploymentInProgress, active.ID, active.Step)
+}
+
+func (j *JobService) known(stream string) bool {
+	for _, s := range j.jobStreams.All() {
+		if s == stream {
+			return true
+		}
+	}
+	return false
+}
+
+func toDeadLetter(stream string, msg redis.XMessage) dto.DeadLetter {
+	out := dto.DeadLetter{
+		ID:         msg.ID,
+		Stream:     stream,
+		OriginalID: stringValue(msg.Values["original_id"]),
+		Reason:     stringValue(msg.Values["reason"]),
+		Payload:    stringValue(msg.Values["payload"]),
+	}
+
+	out.Deliveries, _ = strconv.Atoi(stringValue(msg.Values["deliveries"]))
+	out.FailedAt, _ = time.Parse(time.RFC3339, stringValue(msg.Values["failed_at"]))
+
+	var deployment struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(out.Payload), &deployment); err == nil {
+		out.DeploymentID = deployment.ID
+	}
+
+	return out
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
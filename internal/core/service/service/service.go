@@ -3,8 +3,12 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/elissonalvesilva/releasy/internal/convert"
 	"github.com/elissonalvesilva/releasy/internal/core/domain"
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/core/service/deployment"
 	"github.com/elissonalvesilva/releasy/internal/store"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
 	"github.com/elissonalvesilva/releasy/pkg/utils"
@@ -14,51 +18,135 @@ import (
 
 type (
 	CreateServiceCommand struct {
-		Application string   `json:"application"`
-		ServiceName string   `json:"service_name"`
-		Replicas    int      `json:"replicas"`
-		Envs        []string `json:"envs"`
-		Image       string   `json:"image"`
-		Version     string   `json:"version"`
-		Hostname    string   `json:"hostname"`
-		MaxWaitTime int      `json:"maxWaitTime"`
+		Application       string                 `json:"application"`
+		ServiceName       string                 `json:"service_name"`
+		Replicas          int                    `json:"replicas"`
+		Envs              []string               `json:"envs"`
+		Image             string                 `json:"image"`
+		Version           string                 `json:"version"`
+		Hostname          string                 `json:"hostname"`
+		MaxWaitTime       int                    `json:"maxWaitTime"`
+		Strategy          string                 `json:"strategy"`
+		HealthCheck       *dto.HealthCheck       `json:"health_check,omitempty"`
+		DockerHealthCheck *dto.DockerHealthCheck `json:"docker_health_check,omitempty"`
+		Routes            []dto.Route            `json:"routes,omitempty"`
+		TLS               *dto.TLS               `json:"tls,omitempty"`
+		Middlewares       *dto.Middlewares       `json:"middlewares,omitempty"`
+	}
+
+	UpdateServiceCommand struct {
+		Replicas          *int                   `json:"replicas,omitempty"`
+		Envs              []string               `json:"envs,omitempty"`
+		Hostname          *string                `json:"hostname,omitempty"`
+		Strategy          string                 `json:"strategy,omitempty"`
+		HealthCheck       *dto.HealthCheck       `json:"health_check,omitempty"`
+		DockerHealthCheck *dto.DockerHealthCheck `json:"docker_health_check,omitempty"`
+		// Routes replaces every route of the service, an empty list leaving it on its hostname.
+		Routes *[]dto.Route `json:"routes,omitempty"`
+		TLS    *dto.TLS     `json:"tls,omitempty"`
+		// Middlewares replaces every middleware of the service.
+		Middlewares *dto.Middlewares `json:"middlewares,omitempty"`
 	}
 
 	ServiceUsecase interface {
 		Create(ctx context.Context, command CreateServiceCommand) error
+		List(ctx context.Context, application string) ([]dto.Service, error)
+		Get(ctx context.Context, application, serviceName string) (*dto.Service, error)
+		Update(ctx context.Context, application, serviceName string, command UpdateServiceCommand) (string, error)
+		Delete(ctx context.Context, application, serviceName string) (string, error)
+		SetCertificate(ctx context.Context, application, serviceName string, cert dto.Certificate) (string, error)
+		RemoveCertificate(ctx context.Context, application, serviceName string) (string, error)
 	}
 
 	ServiceService struct {
 		StreamsStore store.Streams
 		db           store.DbStore
+		deployments  deployment.Deployment
+		jobStreams   store.JobStreams
 	}
 )
 
-func NewService(streams store.Streams, db store.DbStore) *ServiceService {
+func NewService(streams store.Streams, db store.DbStore, deployments deployment.Deployment, jobStreams store.JobStreams) *ServiceService {
 	return &ServiceService{
 		StreamsStore: streams,
 		db:           db,
+		deployments:  deployments,
+		jobStreams:   jobStreams,
 	}
 }
 
 func (s *ServiceService) Create(ctx context.Context, command CreateServiceCommand) error {
+	if err := domain.ValidateReplicas(command.Replicas); err != nil {
+		return err
+	}
 
 	buildedEnvs, err := buildEnvsPayload(command.Envs)
 	if err != nil {
 		return err
 	}
 
+	strategy, err := domain.ServiceStrategy(command.Strategy)
+	if err != nil {
+		return err
+	}
+
+	var healthCheck dto.HealthCheck
+	if command.HealthCheck != nil {
+		healthCheck = *command.HealthCheck
+	}
+
+	if err := convert.ToDomainHealthCheck(healthCheck).Validate(); err != nil {
+		return err
+	}
+
+	var dockerHealthCheck dto.DockerHealthCheck
+	if command.DockerHealthCheck != nil {
+		dockerHealthCheck = *command.DockerHealthCheck
+	}
+
+	if err := convert.ToDomainDockerHealthCheck(dockerHealthCheck).Validate(); err != nil {
+		return err
+	}
+
+	if err := domain.ValidateRoutes(command.Hostname, toDomainRoutes(command.Routes)); err != nil {
+		return err
+	}
+
+	var tlsOptions dto.TLS
+	if command.TLS != nil {
+		tlsOptions = *command.TLS
+	}
+
+	if err := convert.ToDomainTLS(tlsOptions).Validate(); err != nil {
+		return err
+	}
+
+	var middlewares dto.Middlewares
+	if command.Middlewares != nil {
+		middlewares = *command.Middlewares
+	}
+
+	if err := toDomainMiddlewares(middlewares).Validate(); err != nil {
+		return err
+	}
+
 	err = s.db.SaveService(ctx, dto.Service{
-		ID:          uuid.NewString(),
-		Application: command.Application,
-		Name:        command.ServiceName,
-		Replicas:    command.Replicas,
-		Envs:        buildedEnvs,
-		Image:       command.Image,
-		Version:     command.Version,
-		Weight:      100,
-		Hostname:    command.Hostname,
-		CreatedAt:   time.Now(),
+		ID:                uuid.NewString(),
+		Application:       command.Application,
+		Name:              command.ServiceName,
+		Replicas:          command.Replicas,
+		Envs:              buildedEnvs,
+		Image:             command.Image,
+		Version:           command.Version,
+		Weight:            100,
+		Hostname:          command.Hostname,
+		Strategy:          strategy,
+		HealthCheck:       healthCheck,
+		DockerHealthCheck: dockerHealthCheck,
+		Routes:            command.Routes,
+		TLS:               tlsOptions,
+		Middlewares:       middlewares,
+		CreatedAt:         time.Now(),
 	})
 
 	if err != nil {
@@ -75,8 +163,8 @@ func (s *ServiceService) Create(ctx context.Context, command CreateServiceComman
 		command.Version,
 		command.Replicas,
 		0,
-		0,
-		command.MaxWaitTime,
+		domain.DefaultHealthCheckIntervalSeconds,
+		utils.GetIntOrDefault(command.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds),
 		command.Envs,
 	)
 
@@ -84,14 +172,22 @@ func (s *ServiceService) Create(ctx context.Context, command CreateServiceComman
 		return err
 	}
 
+	if err := deployment.SetHealthCheck(convert.ToDomainHealthCheck(healthCheck)); err != nil {
+		return err
+	}
+
+	if err := deployment.SetDockerHealthCheck(convert.ToDomainDockerHealthCheck(dockerHealthCheck)); err != nil {
+		return err
+	}
+
 	dtoDeployment := s.toDTODeployment(*deployment)
 	if err = s.db.SaveDeployment(ctx, dtoDeployment); err != nil {
 		return err
 	}
 
-	payload := s.toCreateServiceStreamData(command)
+	payload := s.toStreamData(*deployment)
 
-	err = s.StreamsStore.PublishJob("releasy_jobs", payload)
+	err = s.StreamsStore.PublishJob(s.jobStreams.For(command.Application), payload)
 	if err != nil {
 		logger.WithError(err).Info("create service failed")
 		return err
@@ -100,22 +196,257 @@ func (s *ServiceService) Create(ctx context.Context, command CreateServiceComman
 	return nil
 }
 
-func (s *ServiceService) toCreateServiceStreamData(command CreateServiceCommand) map[string]interface{} {
+func (s *ServiceService) List(ctx context.Context, application string) ([]dto.Service, error) {
+	return s.db.ListServices(ctx, application)
+}
 
-	deployment, _ := domain.NewDeployment(
-		domain.StrategyInitialize,
-		domain.ActionDeployCreate,
-		command.Application,
-		command.ServiceName,
-		command.Image,
-		command.Version,
-		command.Replicas,
+func (s *ServiceService) Get(ctx context.Context, application, serviceName string) (*dto.Service, error) {
+	return s.db.GetService(ctx, application, serviceName)
+}
+
+// Update changes the service definition. A change of replicas, envs or Docker health
+// check redeploys the running version with the service strategy, and is recorded on the
+// service only once that deployment finished. A change of its routes, TLS options or
+// middlewares alone queues a job rewriting its routers. The id of that job is returned.
+func (s *ServiceService) Update(ctx context.Context, application, serviceName string, command UpdateServiceCommand) (string, error) {
+	service, err := s.db.GetService(ctx, application, serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	// The running slot keeps this spec, which a failed redeploy restores.
+	previous := dto.ServiceSpec{
+		Image:             service.Image,
+		Replicas:          service.Replicas,
+		Envs:              service.Envs,
+		DockerHealthCheck: service.DockerHealthCheck,
+	}
+	pending := previous
+	redeploy := false
+
+	if command.Replicas != nil {
+		if err := domain.ValidateReplicas(*command.Replicas); err != nil {
+			return "", err
+		}
+	}
+
+	if command.Replicas != nil && *command.Replicas != service.Replicas {
+		pending.Replicas = *command.Replicas
+		redeploy = true
+	}
+
+	if command.Envs != nil {
+		buildedEnvs, err := buildEnvsPayload(command.Envs)
+		if err != nil {
+			return "", err
+		}
+		if buildedEnvs != service.Envs {
+			pending.Envs = buildedEnvs
+			redeploy = true
+		}
+	}
+
+	reroute := false
+	if command.Hostname != nil && *command.Hostname != service.Hostname {
+		service.Hostname = *command.Hostname
+		reroute = true
+	}
+
+	if command.Routes != nil {
+		service.Routes = *command.Routes
+		reroute = true
+	}
+
+	if command.TLS != nil {
+		if err := convert.ToDomainTLS(*command.TLS).Validate(); err != nil {
+			return "", err
+		}
+		service.TLS = *command.TLS
+		reroute = true
+	}
+
+	if command.Middlewares != nil {
+		if err := toDomainMiddlewares(*command.Middlewares).Validate(); err != nil {
+			return "", err
+		}
+		service.Middlewares = *command.Middlewares
+		reroute = true
+	}
+
+	if reroute {
+		if err := domain.ValidateRoutes(service.Hostname, toDomainRoutes(service.Routes)); err != nil {
+			return "", err
+		}
+	}
+
+	if command.Strategy != "" {
+		strategy, err := domain.ServiceStrategy(command.Strategy)
+		if err != nil {
+			return "", err
+		}
+		service.Strategy = strategy
+	}
+
+	if command.HealthCheck != nil {
+		if err := convert.ToDomainHealthCheck(*command.HealthCheck).Validate(); err != nil {
+			return "", err
+		}
+		service.HealthCheck = *command.HealthCheck
+	}
+
+	if command.DockerHealthCheck != nil {
+		if err := convert.ToDomainDockerHealthCheck(*command.DockerHealthCheck).Validate(); err != nil {
+			return "", err
+		}
+		pending.DockerHealthCheck = *command.DockerHealthCheck
+		redeploy = true
+	}
+
+	if redeploy {
+		if err := s.deployments.EnsureIdle(ctx, application, serviceName); err != nil {
+			return "", err
+		}
+	}
+
+	if err := s.db.UpdateService(ctx, *service); err != nil {
+		logger.WithError(err).Info("update service failed")
+		return "", err
+	}
+
+	if !redeploy {
+		if reroute {
+			// The routers are rewritten by a job, as the agents own the Traefik config.
+			return s.configure(ctx, service, domain.ActionRoutesUpdate)
+		}
+		return "", nil
+	}
+
+	strategy, err := domain.ServiceStrategy(service.Strategy)
+	if err != nil {
+		return "", err
+	}
+
+	return s.deployments.Execute(ctx, deployment.DeploymentCommand{
+		DeploymentStrategy:  strategy,
+		Application:         service.Application,
+		ServiceName:         service.Name,
+		Replicas:            pending.Replicas,
+		Image:               service.Image,
+		Envs:                utils.ParseEnvString(pending.Envs),
+		Version:             domain.NextRevision(service.Version),
+		Action:              domain.ActionDeployCreate,
+		HealthCheckInterval: domain.DefaultHealthCheckIntervalSeconds,
+		MaxWaitTime:         domain.DefaultMaxWaitTimeSeconds,
+		Previous:            &previous,
+		Pending:             &pending,
+	})
+}
+
+// Delete queues a job that removes every slot of the service, its routes and its record.
+func (s *ServiceService) Delete(ctx context.Context, application, serviceName string) (string, error) {
+	service, err := s.db.GetService(ctx, application, serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.deployments.EnsureIdle(ctx, application, serviceName); err != nil {
+		return "", err
+	}
+
+	teardown, err := domain.NewDeployment(
+		domain.StrategyTeardown,
+		domain.ActionServiceDelete,
+		service.Application,
+		service.Name,
+		service.Image,
+		service.Version,
+		service.Replicas,
 		0,
-		domain.DefaultHealthCheckIntervalSeconds,
-		utils.GetIntOrDefault(command.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds),
-		command.Envs,
+		0,
+		0,
+		utils.ParseEnvString(service.Envs),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.SaveDeployment(ctx, s.toDTODeployment(*teardown)); err != nil {
+		if errors.Is(err, store.ErrActiveDeployment) {
+			return "", fmt.Errorf("%w: %s", domain.ErrDeploymentInProgress, err)
+		}
+		return "", err
+	}
+
+	if err := s.StreamsStore.PublishJob(s.jobStreams.For(service.Application), s.toStreamData(*teardown)); err != nil {
+		logger.WithError(err).Info("delete service failed")
+		return "", err
+	}
+
+	return teardown.ID, nil
+}
+
+// SetCertificate stores the certificate of the service and queues a job handing it to
+// Traefik. The id of that job is returned.
+func (s *ServiceService) SetCertificate(ctx context.Context, application, serviceName string, cert dto.Certificate) (string, error) {
+	if err := (domain.Certificate{Cert: cert.Cert, Key: cert.Key}).Validate(); err != nil {
+		return "", err
+	}
+
+	return s.updateCertificate(ctx, application, serviceName, &cert)
+}
+
+// RemoveCertificate deletes the certificate of the service and queues a job removing it
+// from Traefik. The id of that job is returned.
+func (s *ServiceService) RemoveCertificate(ctx context.Context, application, serviceName string) (string, error) {
+	return s.updateCertificate(ctx, application, serviceName, nil)
+}
+
+func (s *ServiceService) updateCertificate(ctx context.Context, application, serviceName string, cert *dto.Certificate) (string, error) {
+	service, err := s.db.GetService(ctx, application, serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.SetServiceCertificate(ctx, application, serviceName, cert); err != nil {
+		logger.WithError(err).Info("update certificate failed")
+		return "", err
+	}
+
+	return s.configure(ctx, service, domain.ActionRoutesUpdate)
+}
+
+// configure queues a job applying the service definition without redeploying it.
+func (s *ServiceService) configure(ctx context.Context, service *dto.Service, action string) (string, error) {
+	job, err := domain.NewDeployment(
+		domain.StrategyConfigure,
+		action,
+		service.Application,
+		service.Name,
+		service.Image,
+		service.Version,
+		service.Replicas,
+		0,
+		0,
+		0,
+		utils.ParseEnvString(service.Envs),
 	)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.db.SaveDeployment(ctx, s.toDTODeployment(*job)); err != nil {
+		return "", err
+	}
+
+	if err := s.StreamsStore.PublishJob(s.jobStreams.For(service.Application), s.toStreamData(*job)); err != nil {
+		logger.WithError(err).Info("configure service failed")
+		return "", err
+	}
 
+	return job.ID, nil
+}
+
+func (s *ServiceService) toStreamData(deployment domain.Deployment) map[string]interface{} {
 	deploymentValue := map[string]interface{}{
 		"id":                    deployment.ID,
 		"application":           deployment.Application,
@@ -129,6 +460,8 @@ func (s *ServiceService) toCreateServiceStreamData(command CreateServiceCommand)
 		"max_wait_time":         deployment.MaxWaitTime,
 		"env":                   deployment.Envs,
 		"action":                deployment.Action,
+		"health_check":          convert.ToDTOHealthCheck(deployment.HealthCheck),
+		"docker_health_check":   convert.ToDTODockerHealthCheck(deployment.DockerHealthCheck),
 		"created_at":            deployment.CreatedAt,
 	}
 
@@ -142,14 +475,6 @@ func (s *ServiceService) toCreateServiceStreamData(command CreateServiceCommand)
 	return payload
 }
 
-func (s *ServiceService) toEnvString(envs []string) string {
-	var envString string
-	for _, env := range envs {
-		envString += env + ","
-	}
-	return envString
-}
-
 func (d *ServiceService) toDTODeployment(deployment domain.Deployment) dto.Deployment {
 	return dto.Deployment{
 		ID:                 deployment.ID,
@@ -164,10 +489,66 @@ func (d *ServiceService) toDTODeployment(deployment domain.Deployment) dto.Deplo
 		MaxWaitTime:        deployment.MaxWaitTime,
 		Action:             deployment.Action,
 		Step:               deployment.Step,
+		HealthCheck:        convert.ToDTOHealthCheck(deployment.HealthCheck),
+		DockerHealthCheck:  convert.ToDTODockerHealthCheck(deployment.DockerHealthCheck),
 		CreatedAt:          deployment.CreatedAt,
 	}
 }
 
+func toDomainMiddlewares(m dto.Middlewares) domain.Middlewares {
+	middlewares := domain.Middlewares{
+		Compress:       m.Compress,
+		StripPrefix:    m.StripPrefix,
+		IPAllowList:    m.IPAllowList,
+		CircuitBreaker: m.CircuitBreaker,
+	}
+
+	if r := m.RateLimit; r != nil {
+		middlewares.RateLimit = &domain.RateLimit{Average: r.Average, Burst: r.Burst, PeriodSeconds: r.PeriodSeconds}
+	}
+
+	if h := m.Headers; h != nil {
+		middlewares.Headers = &domain.Headers{
+			CustomRequestHeaders:          h.CustomRequestHeaders,
+			CustomResponseHeaders:         h.CustomResponseHeaders,
+			AccessControlAllowOrigins:     h.AccessControlAllowOrigins,
+			AccessControlAllowMethods:     h.AccessControlAllowMethods,
+			AccessControlAllowHeaders:     h.AccessControlAllowHeaders,
+			AccessControlAllowCredentials: h.AccessControlAllowCredentials,
+			AccessControlMaxAge:           h.AccessControlMaxAge,
+			STSSeconds:                    h.STSSeconds,
+			FrameDeny:                     h.FrameDeny,
+			ContentTypeNosniff:            h.ContentTypeNosniff,
+			BrowserXSSFilter:              h.BrowserXSSFilter,
+			ReferrerPolicy:                h.ReferrerPolicy,
+		}
+	}
+
+	if b := m.BasicAuth; b != nil {
+		middlewares.BasicAuth = &domain.BasicAuth{Users: b.Users, Realm: b.Realm}
+	}
+
+	if r := m.Retry; r != nil {
+		middlewares.Retry = &domain.Retry{Attempts: r.Attempts, InitialIntervalMs: r.InitialIntervalMs}
+	}
+
+	return middlewares
+}
+
+func toDomainRoutes(routes []dto.Route) []domain.Route {
+	var out []domain.Route
+	for _, r := range routes {
+		out = append(out, domain.Route{
+			Hosts:      r.Hosts,
+			PathPrefix: r.PathPrefix,
+			Headers:    r.Headers,
+			Rule:       r.Rule,
+			Priority:   r.Priority,
+		})
+	}
+	return out
+}
+
 func buildEnvsPayload(envs []string) (string, error) {
 	envsJSON, err := json.Marshal(envs)
 
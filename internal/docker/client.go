@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/containerd/errdefs"
@@ -8,11 +9,14 @@ import (
 	image2 "github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type (
@@ -22,13 +26,46 @@ type (
 	}
 
 	DockerClient interface {
-		CreateService(serviceName, slot, image string, replicas uint64, envs []string, port int, isInitial bool) error
+		EnsureImage(image string) (bool, error)
+		CreateService(serviceName, slot, image string, replicas uint64, envs []string, port int, healthCheck HealthCheck) ([]string, error)
 		ListServices() ([]string, error)
 		RemoveSlot(serviceName, slot string) error
 		Close() error
 		GetReplicas(serviceName, slot string) (uint64, error)
 		ListBySlot(serviceName, slot string) ([]string, error)
+		CreateReplica(serviceName, slot, image string, index int, envs []string, port int, healthCheck HealthCheck) (string, error)
+		RemoveContainer(name string) error
 		GetServiceImage(serviceName, slot string) (string, error)
+		Exec(ctx context.Context, target string, cmd []string) ([]ExecResult, error)
+		ContainerIP(name string) (string, error)
+		ContainerState(name string) (ContainerState, error)
+	}
+
+	// ContainerState is what Docker reports about a container. Health is empty when the
+	// container has no health check.
+	ContainerState struct {
+		Status       string
+		Health       string
+		ExitCode     int
+		RestartCount int
+	}
+
+	// HealthCheck is the check Docker runs in a container. Without any field set the
+	// container keeps the health check of its image.
+	HealthCheck struct {
+		Test        []string
+		Interval    time.Duration
+		Timeout     time.Duration
+		StartPeriod time.Duration
+		Retries     int
+		Disable     bool
+	}
+
+	// ExecResult is the outcome of a command run in one container.
+	ExecResult struct {
+		Container string
+		ExitCode  int
+		Output    string
 	}
 )
 
@@ -44,13 +81,10 @@ func (c *dockerClient) Close() error {
 	return c.cli.Close()
 }
 
-func (c *dockerClient) CreateService(serviceName, slot string, image string, replicas uint64, envs []string, port int, isInitial bool) error {
+func (c *dockerClient) CreateService(serviceName, slot string, image string, replicas uint64, envs []string, port int, healthCheck HealthCheck) ([]string, error) {
 	ctx := context.Background()
 
-	base := strings.ToLower(strings.TrimSpace(serviceName))
-	slot = strings.ToLower(strings.TrimSpace(slot))
-	targetName := fmt.Sprintf("%s-%s", base, slot)
-	safeName := regexp.MustCompile(`[^a-z0-9-]+`).ReplaceAllString(targetName, "-")
+	_, safeName, targetName := slotNames(serviceName, slot)
 
 	logger.WithFields(map[string]interface{}{
 		"service": safeName,
@@ -58,6 +92,57 @@ func (c *dockerClient) CreateService(serviceName, slot string, image string, rep
 		"slot":    slot,
 	}).Info("Creating containers")
 
+	if _, err := c.ensureImage(ctx, image); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for i := 0; i < int(replicas); i++ {
+		name, err := c.createReplica(ctx, safeName, targetName, slot, image, i+1, envs, port, healthCheck, map[string]string{})
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+func (c *dockerClient) CreateReplica(serviceName, slot, image string, index int, envs []string, port int, healthCheck HealthCheck) (string, error) {
+	ctx := context.Background()
+
+	_, safeName, targetName := slotNames(serviceName, slot)
+
+	if _, err := c.ensureImage(ctx, image); err != nil {
+		return "", err
+	}
+
+	return c.createReplica(ctx, safeName, targetName, slot, image, index, envs, port, healthCheck, map[string]string{})
+}
+
+func (c *dockerClient) RemoveContainer(name string) error {
+	ctx := context.Background()
+	name = strings.TrimPrefix(name, "/")
+
+	logger.WithField("container", name).Info("Removing container")
+	_ = c.cli.ContainerStop(ctx, name, container.StopOptions{})
+	if err := c.cli.ContainerRemove(ctx, name, container.RemoveOptions{Force: true}); err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil
+		}
+		logger.WithError(err).Errorf("Failed to remove container: %s", name)
+		return err
+	}
+
+	return nil
+}
+
+// EnsureImage pulls image when it is not available locally and reports whether it was pulled.
+func (c *dockerClient) EnsureImage(image string) (bool, error) {
+	return c.ensureImage(context.Background(), image)
+}
+
+func (c *dockerClient) ensureImage(ctx context.Context, image string) (bool, error) {
 	_, err := c.cli.ImageInspect(ctx, image)
 	if err != nil {
 		if errdefs.IsNotFound(err) {
@@ -65,76 +150,66 @@ func (c *dockerClient) CreateService(serviceName, slot string, image string, rep
 			rc, pullErr := c.cli.ImagePull(ctx, image, image2.PullOptions{})
 			if pullErr != nil {
 				logger.WithError(pullErr).Error("Failed to pull image")
-				return pullErr
+				return false, pullErr
 			}
 			defer rc.Close()
 			io.Copy(io.Discard, rc)
-		} else {
-			logger.WithError(err).Error("Failed to inspect image")
-			return err
+			return true, nil
 		}
-	} else {
-		logger.Info(fmt.Sprintf("Image %s found locally, skip pulling", image))
-	}
-
-	for i := 0; i < int(replicas); i++ {
-		instanceName := fmt.Sprintf("%s-%d", safeName, i+1)
-		exposedPort := nat.Port(fmt.Sprintf("%d/tcp", port))
 
-		labels := map[string]string{
-			"traefik.enable": "true",
-			fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", targetName): fmt.Sprintf("%d", port),
-		}
+		logger.WithError(err).Error("Failed to inspect image")
+		return false, err
+	}
 
-		if isInitial {
-			labels[fmt.Sprintf("traefik.http.routers.%s.rule", base)] = fmt.Sprintf("Host(`%s.local`)", base)
-			//labels[fmt.Sprintf("traefik.http.routers.%s.service", base)] = fmt.Sprintf("%s-svc", base)
-		}
+	logger.Info(fmt.Sprintf("Image %s found locally, skip pulling", image))
+	return false, nil
+}
 
-		resp, err := c.cli.ContainerCreate(ctx,
-			&container.Config{
-				Image:        image,
-				Env:          envs,
-				ExposedPorts: nat.PortSet{exposedPort: struct{}{}},
-				Labels:       labels,
-				//Healthcheck: &container.HealthConfig{
-				//	Test:     []string{"CMD-SHELL", fmt.Sprintf("curl -f http://localhost:%d/ping || exit 1", port)},
-				//	Interval: 30 * time.Second,
-				//	Timeout:  5 * time.Second,
-				//	Retries:  10,
-				//},
-			},
-			&container.HostConfig{
-				NetworkMode: container.NetworkMode(c.networkName),
-			},
-			&network.NetworkingConfig{
-				EndpointsConfig: map[string]*network.EndpointSettings{
-					c.networkName: {
-						Aliases: []string{safeName},
-					},
+func (c *dockerClient) createReplica(ctx context.Context, safeName, targetName, slot, image string, index int, envs []string, port int, healthCheck HealthCheck, labels map[string]string) (string, error) {
+	instanceName := fmt.Sprintf("%s-%d", safeName, index)
+	exposedPort := nat.Port(fmt.Sprintf("%d/tcp", port))
+
+	labels["traefik.enable"] = "true"
+	labels[fmt.Sprintf("traefik.http.services.%s.loadbalancer.server.port", targetName)] = fmt.Sprintf("%d", port)
+
+	resp, err := c.cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:        image,
+			Env:          envs,
+			ExposedPorts: nat.PortSet{exposedPort: struct{}{}},
+			Labels:       labels,
+			Healthcheck:  healthConfig(healthCheck),
+		},
+		&container.HostConfig{
+			NetworkMode: container.NetworkMode(c.networkName),
+		},
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				c.networkName: {
+					Aliases: []string{safeName},
 				},
 			},
-			nil,
-			instanceName,
-		)
-		if err != nil {
-			logger.WithError(err).Error("Failed to create container")
-			return err
-		}
-
-		if err := c.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-			logger.WithError(err).Error("Failed to start container")
-			return err
-		}
+		},
+		nil,
+		instanceName,
+	)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create container")
+		return "", err
+	}
 
-		logger.WithFields(map[string]interface{}{
-			"container": instanceName,
-			"slot":      slot,
-			"port":      port,
-		}).Info("Container created & started")
+	if err := c.cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		logger.WithError(err).Error("Failed to start container")
+		return "", err
 	}
 
-	return nil
+	logger.WithFields(map[string]interface{}{
+		"container": instanceName,
+		"slot":      slot,
+		"port":      port,
+	}).Info("Container created & started")
+
+	return instanceName, nil
 }
 
 func (c *dockerClient) ListServices() ([]string, error) {
@@ -158,7 +233,7 @@ func (c *dockerClient) ListServices() ([]string, error) {
 
 func (c *dockerClient) RemoveSlot(serviceName, slot string) error {
 	ctx := context.Background()
-	targetPrefix := fmt.Sprintf("%s-%s", strings.ToLower(serviceName), strings.ToLower(slot))
+	_, safeName, _ := slotNames(serviceName, slot)
 
 	containers, err := c.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
@@ -170,7 +245,7 @@ func (c *dockerClient) RemoveSlot(serviceName, slot string) error {
 	for _, cont := range containers {
 		for _, name := range cont.Names {
 			cleanName := strings.TrimPrefix(name, "/")
-			if strings.HasPrefix(cleanName, targetPrefix) {
+			if inSlot(cleanName, safeName) {
 				logger.WithField("container", cleanName).Info("Removing container")
 				if cont.State == "running" {
 					_ = c.cli.ContainerStop(ctx, cont.ID, container.StopOptions{})
@@ -185,7 +260,7 @@ func (c *dockerClient) RemoveSlot(serviceName, slot string) error {
 	}
 
 	if !found {
-		logger.WithField("prefix", targetPrefix).Warn("No containers found to remove")
+		logger.WithField("slot", safeName).Warn("No containers found to remove")
 	}
 
 	return nil
@@ -193,7 +268,7 @@ func (c *dockerClient) RemoveSlot(serviceName, slot string) error {
 
 func (c *dockerClient) GetReplicas(serviceName, slot string) (uint64, error) {
 	ctx := context.Background()
-	targetPrefix := fmt.Sprintf("%s-%s", strings.ToLower(serviceName), strings.ToLower(slot))
+	_, safeName, _ := slotNames(serviceName, slot)
 
 	containers, err := c.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
@@ -204,7 +279,7 @@ func (c *dockerClient) GetReplicas(serviceName, slot string) (uint64, error) {
 	var count uint64
 	for _, cont := range containers {
 		for _, name := range cont.Names {
-			if strings.HasPrefix(strings.TrimPrefix(name, "/"), targetPrefix) {
+			if inSlot(strings.TrimPrefix(name, "/"), safeName) {
 				count++
 			}
 		}
@@ -221,7 +296,7 @@ func (c *dockerClient) GetReplicas(serviceName, slot string) (uint64, error) {
 
 func (c *dockerClient) ListBySlot(serviceName, slot string) ([]string, error) {
 	ctx := context.Background()
-	targetPrefix := fmt.Sprintf("%s-%s", strings.ToLower(serviceName), strings.ToLower(slot))
+	_, safeName, _ := slotNames(serviceName, slot)
 
 	containers, err := c.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
@@ -232,7 +307,7 @@ func (c *dockerClient) ListBySlot(serviceName, slot string) ([]string, error) {
 	var names []string
 	for _, cont := range containers {
 		for _, name := range cont.Names {
-			if strings.HasPrefix(strings.TrimPrefix(name, "/"), targetPrefix) {
+			if inSlot(strings.TrimPrefix(name, "/"), safeName) {
 				names = append(names, name)
 			}
 		}
@@ -243,7 +318,7 @@ func (c *dockerClient) ListBySlot(serviceName, slot string) ([]string, error) {
 
 func (c *dockerClient) GetServiceImage(serviceName, slot string) (string, error) {
 	ctx := context.Background()
-	targetPrefix := fmt.Sprintf("%s-%s", strings.ToLower(serviceName), strings.ToLower(slot))
+	_, safeName, _ := slotNames(serviceName, slot)
 
 	containers, err := c.cli.ContainerList(ctx, container.ListOptions{All: true})
 	if err != nil {
@@ -253,7 +328,7 @@ func (c *dockerClient) GetServiceImage(serviceName, slot string) (string, error)
 
 	for _, cont := range containers {
 		for _, name := range cont.Names {
-			if strings.HasPrefix(strings.TrimPrefix(name, "/"), targetPrefix) {
+			if inSlot(strings.TrimPrefix(name, "/"), safeName) {
 				return cont.Image, nil
 			}
 		}
@@ -261,3 +336,163 @@ func (c *dockerClient) GetServiceImage(serviceName, slot string) (string, error)
 
 	return "", fmt.Errorf("no container found for %s-%s", serviceName, slot)
 }
+
+// ContainerIP returns the address of a container on the releasy network.
+func (c *dockerClient) ContainerIP(name string) (string, error) {
+	inspect, err := c.cli.ContainerInspect(context.Background(), strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return "", err
+	}
+
+	if inspect.NetworkSettings == nil {
+		return "", fmt.Errorf("container %s has no network", name)
+	}
+
+	endpoint, ok := inspect.NetworkSettings.Networks[c.networkName]
+	if !ok || endpoint == nil || endpoint.IPAddress == "" {
+		return "", fmt.Errorf("container %s has no address on %s", name, c.networkName)
+	}
+
+	return endpoint.IPAddress, nil
+}
+
+// ContainerState returns what Docker reports about the state and health of a container.
+func (c *dockerClient) ContainerState(name string) (ContainerState, error) {
+	inspect, err := c.cli.ContainerInspect(context.Background(), strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return ContainerState{}, err
+	}
+
+	if inspect.State == nil {
+		return ContainerState{}, fmt.Errorf("container %s has no state", name)
+	}
+
+	state := ContainerState{
+		Status:       inspect.State.Status,
+		ExitCode:     inspect.State.ExitCode,
+		RestartCount: inspect.RestartCount,
+	}
+	if inspect.State.Health != nil {
+		state.Health = inspect.State.Health.Status
+	}
+
+	return state, nil
+}
+
+// Exec runs cmd in the running container named target or, when target is the alias of
+// a slot, in every running container of that slot.
+func (c *dockerClient) Exec(ctx context.Context, target string, cmd []string) ([]ExecResult, error) {
+	containers, err := c.cli.ContainerList(ctx, container.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	target = strings.ToLower(target)
+	var results []ExecResult
+	for _, cont := range containers {
+		for _, name := range cont.Names {
+			cleanName := strings.TrimPrefix(name, "/")
+			if cleanName != target && !inSlot(cleanName, target) {
+				continue
+			}
+
+			result, err := c.exec(ctx, cont.ID, cmd)
+			if err != nil {
+				return nil, fmt.Errorf("exec in %s: %w", cleanName, err)
+			}
+			result.Container = cleanName
+			results = append(results, result)
+		}
+	}
+
+	if len(results) == 0 {
+		return nil, fmt.Errorf("no running container found for %s", target)
+	}
+
+	return results, nil
+}
+
+func (c *dockerClient) exec(ctx context.Context, containerID string, cmd []string) (ExecResult, error) {
+	created, err := c.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	attached, err := c.cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return ExecResult{}, err
+	}
+	defer attached.Close()
+
+	// The attached stream does not follow ctx on its own.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			attached.Close()
+		case <-done:
+		}
+	}()
+
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, attached.Reader); err != nil {
+		return ExecResult{}, err
+	}
+
+	inspect, err := c.cli.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	return ExecResult{ExitCode: inspect.ExitCode, Output: output.String()}, nil
+}
+
+// healthConfig turns the health check of the service into the one of the container.
+func healthConfig(h HealthCheck) *container.HealthConfig {
+	if h.Disable {
+		return &container.HealthConfig{Test: []string{"NONE"}}
+	}
+
+	if len(h.Test) == 0 && h.Interval == 0 && h.Timeout == 0 && h.StartPeriod == 0 && h.Retries == 0 {
+		return nil
+	}
+
+	return &container.HealthConfig{
+		Test:        h.Test,
+		Interval:    h.Interval,
+		Timeout:     h.Timeout,
+		StartPeriod: h.StartPeriod,
+		Retries:     h.Retries,
+	}
+}
+
+// InSlot reports whether the container named name is one of the replicas of the slot
+// of serviceName.
+func InSlot(name, serviceName, slot string) bool {
+	_, safeName, _ := slotNames(serviceName, slot)
+	return inSlot(strings.TrimPrefix(name, "/"), safeName)
+}
+
+// inSlot reports whether name is a replica <safeName>-<n> of the slot, and not one of a
+// slot whose name starts the same, such as v1-r1 for v1.
+func inSlot(name, safeName string) bool {
+	index, ok := strings.CutPrefix(name, safeName+"-")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseUint(index, 10, 64)
+	return err == nil
+}
+
+func slotNames(serviceName, slot string) (string, string, string) {
+	base := strings.ToLower(strings.TrimSpace(serviceName))
+	slot = strings.ToLower(strings.TrimSpace(slot))
+	targetName := fmt.Sprintf("%s-%s", base, slot)
+	safeName := regexp.MustCompile(`[^a-z0-9-]+`).ReplaceAllString(targetName, "-")
+	return base, safeName, targetName
+}
@@ -0,0 +1,132 @@
+package fakes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/elissonalvesilva/releasy/internal/docker"
+)
+
+// Docker keeps the containers of every slot in memory, named <service>-<slot>-<index>
+// as Docker names them. The methods it does not implement panic through the nil
+// docker.DockerClient it embeds.
+type Docker struct {
+	docker.DockerClient
+
+	mu         sync.Mutex
+	containers map[string]string
+	Images     map[string]string
+
+	// EnsureImageErr and CreateErr make the matching calls fail.
+	EnsureImageErr error
+	CreateErr      error
+}
+
+func NewDocker() *Docker {
+	return &Docker{
+		containers: map[string]string{},
+		Images:     map[string]string{},
+	}
+}
+
+func slotKey(serviceName, slot string) string {
+	return serviceName + "-" + slot
+}
+
+// AddSlot starts replicas containers in the slot of serviceName, as an earlier
+// deployment would have.
+func (d *Docker) AddSlot(serviceName, slot string, replicas int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := 1; i <= replicas; i++ {
+		d.containers[fmt.Sprintf("%s-%d", slotKey(serviceName, slot), i)] = slotKey(serviceName, slot)
+	}
+}
+
+// Slot returns the sorted names of the containers running in the slot of serviceName.
+func (d *Docker) Slot(serviceName, slot string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var names []string
+	for name, key := range d.containers {
+		if key == slotKey(serviceName, slot) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (d *Docker) EnsureImage(image string) (bool, error) {
+	if d.EnsureImageErr != nil {
+		return false, d.EnsureImageErr
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, present := d.Images[image]
+	d.Images[image] = image
+	return !present, nil
+}
+
+func (d *Docker) CreateService(serviceName, slot, image string, replicas uint64, envs []string, port int, healthCheck docker.HealthCheck) ([]string, error) {
+	var names []string
+	for i := 1; i <= int(replicas); i++ {
+		name, err := d.CreateReplica(serviceName, slot, image, i, envs, port, healthCheck)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (d *Docker) CreateReplica(serviceName, slot, _ string, index int, _ []string, _ int, _ docker.HealthCheck) (string, error) {
+	if d.CreateErr != nil {
+		return "", d.CreateErr
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%d", slotKey(serviceName, slot), index)
+	if _, ok := d.containers[name]; ok {
+		return "", fmt.Errorf("container %s already exists", name)
+	}
+	d.containers[name] = slotKey(serviceName, slot)
+	return name, nil
+}
+
+// ListBySlot returns the names prefixed with a slash, as the Docker API does.
+func (d *Docker) ListBySlot(serviceName, slot string) ([]string, error) {
+	var names []string
+	for _, name := range d.Slot(serviceName, slot) {
+		names = append(names, "/"+name)
+	}
+	return names, nil
+}
+
+func (d *Docker) RemoveSlot(serviceName, slot string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for name, key := range d.containers {
+		if key == slotKey(serviceName, slot) {
+			delete(d.containers, name)
+		}
+	}
+	return nil
+}
+
+func (d *Docker) RemoveContainer(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.containers, strings.TrimPrefix(name, "/"))
+	return nil
+}
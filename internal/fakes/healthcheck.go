@@ -0,0 +1,56 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+)
+
+var ErrUnhealthy = errors.New("unhealthy")
+
+// HealthChecker answers every probe at once. Hosts are unhealthy when they are in
+// Unhealthy, and so are slots, keyed <service>-<slot>.
+type HealthChecker struct {
+	mu        sync.Mutex
+	Unhealthy map[string]bool
+}
+
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{Unhealthy: map[string]bool{}}
+}
+
+// SetUnhealthy makes the probes of the host or slot fail, or pass again.
+func (h *HealthChecker) SetUnhealthy(target string, unhealthy bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.Unhealthy[target] = unhealthy
+}
+
+func (h *HealthChecker) Ping(ctx context.Context, url string, port int, _ int, spec dto.HealthCheck) error {
+	return h.Check(ctx, url, port, spec)
+}
+
+func (h *HealthChecker) Check(_ context.Context, url string, _ int, _ dto.HealthCheck) error {
+	return h.probe(url)
+}
+
+func (h *HealthChecker) PingSlot(ctx context.Context, serviceName, slot string, port int, _ int, spec dto.HealthCheck) error {
+	return h.CheckSlot(ctx, serviceName, slot, port, spec)
+}
+
+func (h *HealthChecker) CheckSlot(_ context.Context, serviceName, slot string, _ int, _ dto.HealthCheck) error {
+	return h.probe(slotKey(serviceName, slot))
+}
+
+func (h *HealthChecker) probe(target string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.Unhealthy[target] {
+		return ErrUnhealthy
+	}
+	return nil
+}
@@ -0,0 +1,303 @@
+// Package fakes keeps the stores and clients used by the agent and its jobs in memory,
+// for tests.
+package fakes
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// Store keeps deployments, services and events in memory. The methods it does not
+// implement panic through the nil store.DbStore it embeds.
+type Store struct {
+	store.DbStore
+
+	mu          sync.Mutex
+	Deployments map[string]store.Deployment
+	Services    map[string]dto.Service
+	Steps       map[string][]string
+	Events      []store.Event
+}
+
+func NewStore() *Store {
+	return &Store{
+		Deployments: map[string]store.Deployment{},
+		Services:    map[string]dto.Service{},
+		Steps:       map[string][]string{},
+	}
+}
+
+func serviceKey(application, serviceName string) string {
+	return application + "/" + serviceName
+}
+
+// AddService stores s as it would have been created.
+func (s *Store) AddService(svc dto.Service) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Services[serviceKey(svc.Application, svc.Name)] = svc
+}
+
+// Step returns the step recorded for the deployment id.
+func (s *Store) Step(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Deployments[id].Step
+}
+
+func (s *Store) SaveDeployment(_ context.Context, d dto.Deployment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Deployments[d.ID] = store.Deployment{
+		ID:          d.ID,
+		Application: d.Application,
+		ServiceName: d.ServiceName,
+		Strategy:    d.DeploymentStrategy,
+		Version:     d.Version,
+		Replicas:    d.Replicas,
+		Image:       d.Image,
+		Action:      d.Action,
+		Step:        d.Step,
+		CreatedAt:   time.Now(),
+	}
+	s.Steps[d.ID] = append(s.Steps[d.ID], d.Step)
+	return nil
+}
+
+func (s *Store) UpdateDeploymentStep(_ context.Context, id string, step string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.Deployments[id]
+	if !ok {
+		return store.ErrNotFound
+	}
+	d.Step = step
+	d.UpdatedAt = time.Now()
+	s.Deployments[id] = d
+	s.Steps[id] = append(s.Steps[id], step)
+	return nil
+}
+
+func (s *Store) GetDeploymentByID(_ context.Context, id string) (*store.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.Deployments[id]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &d, nil
+}
+
+func (s *Store) ClaimDeployment(_ context.Context, id, owner, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.Deployments[id]
+	if !ok {
+		return nil
+	}
+	d.Owner = owner
+	d.Payload = payload
+	s.Deployments[id] = d
+	return nil
+}
+
+func (s *Store) ListOwnedDeployments(_ context.Context, owner string, excludeSteps []string) ([]store.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var owned []store.Deployment
+	for _, d := range s.Deployments {
+		if d.Owner == owner && !slices.Contains(excludeSteps, d.Step) {
+			owned = append(owned, d)
+		}
+	}
+	return owned, nil
+}
+
+func (s *Store) GetActiveDeployment(_ context.Context, application, serviceName string, excludeSteps []string) (*store.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var active *store.Deployment
+	for _, d := range s.Deployments {
+		if d.Application != application || d.ServiceName != serviceName || slices.Contains(excludeSteps, d.Step) {
+			continue
+		}
+		if active == nil || d.CreatedAt.After(active.CreatedAt) {
+			d := d
+			active = &d
+		}
+	}
+	if active == nil {
+		return nil, store.ErrNotFound
+	}
+	return active, nil
+}
+
+func (s *Store) GetService(_ context.Context, application, serviceName string) (*dto.Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	svc, ok := s.Services[serviceKey(application, serviceName)]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &svc, nil
+}
+
+func (s *Store) UpdateService(_ context.Context, svc dto.Service) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := serviceKey(svc.Application, svc.Name)
+	if _, ok := s.Services[key]; !ok {
+		return store.ErrNotFound
+	}
+	s.Services[key] = svc
+	return nil
+}
+
+func (s *Store) DeleteService(_ context.Context, application, serviceName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := serviceKey(application, serviceName)
+	if _, ok := s.Services[key]; !ok {
+		return store.ErrNotFound
+	}
+	delete(s.Services, key)
+	return nil
+}
+
+func (s *Store) SaveEvent(_ context.Context, e store.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Events = append(s.Events, e)
+	return nil
+}
+
+// Streams records what is done with the jobs instead of talking to Redis. The
+// methods it does not implement panic through the nil store.Streams it embeds.
+type Streams struct {
+	store.Streams
+
+	mu           sync.Mutex
+	Pending      map[string][]store.PendingJob
+	Acked        []string
+	DeadLettered map[string]string
+}
+
+func NewStreams() *Streams {
+	return &Streams{
+		Pending:      map[string][]store.PendingJob{},
+		DeadLettered: map[string]string{},
+	}
+}
+
+// IsAcked reports whether the job entry id was acknowledged.
+func (s *Streams) IsAcked(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Contains(s.Acked, id)
+}
+
+// DeadLetterReason returns why the job entry id was dead-lettered, if it was.
+func (s *Streams) DeadLetterReason(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reason, ok := s.DeadLettered[id]
+	return reason, ok
+}
+
+func (s *Streams) AckJob(_, _, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Acked = append(s.Acked, id)
+	return nil
+}
+
+func (s *Streams) TouchJob(_, _, _, _ string) error {
+	return nil
+}
+
+// ReclaimJobs hands out the jobs put in Pending for stream, once.
+func (s *Streams) ReclaimJobs(stream, _, _ string, _ time.Duration, _ int64) ([]store.PendingJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := s.Pending[stream]
+	delete(s.Pending, stream)
+	return pending, nil
+}
+
+func (s *Streams) DeadLetterJob(_ string, job store.PendingJob, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.DeadLettered[job.Message.ID] = reason
+	return nil
+}
+
+func (s *Streams) Publish(_ string, _ string) error {
+	return nil
+}
+
+func (s *Streams) Subscribe(_ context.Context, _ string) (<-chan *redis.Message, func() error, error) {
+	return make(chan *redis.Message), func() error { return nil }, nil
+}
+
+// Locker grants a free service lock to whoever asks first.
+type Locker struct {
+	mu     sync.Mutex
+	owners map[string]string
+}
+
+func NewLocker() *Locker {
+	return &Locker{owners: map[string]string{}}
+}
+
+func (l *Locker) AcquireServiceLock(application, serviceName, owner string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := serviceKey(application, serviceName)
+	if current, ok := l.owners[key]; ok && current != owner {
+		return false, nil
+	}
+	l.owners[key] = owner
+	return true, nil
+}
+
+func (l *Locker) RefreshServiceLock(application, serviceName, owner string, _ time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.owners[serviceKey(application, serviceName)] == owner, nil
+}
+
+func (l *Locker) ReleaseServiceLock(application, serviceName, owner string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := serviceKey(application, serviceName)
+	if l.owners[key] == owner {
+		delete(l.owners, key)
+	}
+	return nil
+}
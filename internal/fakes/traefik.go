@@ -0,0 +1,165 @@
+package fakes
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+)
+
+// Traefik keeps the routes, certificates and weighted backends of every service in
+// memory and finds their slots the way the file provider client does.
+type Traefik struct {
+	mu           sync.Mutex
+	Routes       map[string]traefik.ServiceRoutes
+	Certificates map[string]string
+	Backends     map[string][]traefik.WeightedBackend
+	Pointed      map[string]string
+
+	// InsertErr makes InsertWeightedService fail.
+	InsertErr error
+}
+
+func NewTraefik() *Traefik {
+	return &Traefik{
+		Routes:       map[string]traefik.ServiceRoutes{},
+		Certificates: map[string]string{},
+		Backends:     map[string][]traefik.WeightedBackend{},
+		Pointed:      map[string]string{},
+	}
+}
+
+func (t *Traefik) EnsureRouter(application, serviceName string, routes traefik.ServiceRoutes) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Routes[serviceKey(application, serviceName)] = routes
+	return nil
+}
+
+func (t *Traefik) SetCertificate(application, serviceName, cert, _ string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Certificates[serviceKey(application, serviceName)] = cert
+	return nil
+}
+
+func (t *Traefik) RemoveCertificate(application, serviceName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.Certificates, serviceKey(application, serviceName))
+	return nil
+}
+
+func (t *Traefik) InsertWeightedService(application, serviceName string, backends []traefik.WeightedBackend) error {
+	if t.InsertErr != nil {
+		return t.InsertErr
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Backends[serviceKey(application, serviceName)] = slices.Clone(backends)
+	return nil
+}
+
+func (t *Traefik) GetCurrentSlot(application, serviceName string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var current traefik.WeightedBackend
+	for _, b := range t.Backends[serviceKey(application, serviceName)] {
+		if b.Weight > current.Weight {
+			current = b
+		}
+	}
+	if current.Name == "" {
+		return "", fmt.Errorf("no slot of %s receives traffic", serviceName)
+	}
+	return slotOf(serviceName, current.Name), nil
+}
+
+func (t *Traefik) GetCandidateSlot(application, serviceName string) (string, error) {
+	current, err := t.GetCurrentSlot(application, serviceName)
+	if err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range t.Backends[serviceKey(application, serviceName)] {
+		if slot := slotOf(serviceName, b.Name); slot != current {
+			return slot, nil
+		}
+	}
+	return "", fmt.Errorf("no candidate slot for %s", serviceName)
+}
+
+func (t *Traefik) GetNoWeightSlot(application, serviceName string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, b := range t.Backends[serviceKey(application, serviceName)] {
+		if b.Weight == 0 {
+			return slotOf(serviceName, b.Name), nil
+		}
+	}
+	return "", fmt.Errorf("no slot without weight for %s", serviceName)
+}
+
+// PointRouterTo records the slot the router of the service was last pointed at.
+func (t *Traefik) PointRouterTo(application, serviceName, slot string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := serviceKey(application, serviceName)
+	if _, ok := t.Routes[key]; !ok {
+		return fmt.Errorf("router %s not found", serviceName)
+	}
+	t.Pointed[key] = slot
+	return nil
+}
+
+func (t *Traefik) GetSlots(application, serviceName string) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var slots []string
+	for _, b := range t.Backends[serviceKey(application, serviceName)] {
+		slots = append(slots, slotOf(serviceName, b.Name))
+	}
+	return slots, nil
+}
+
+func (t *Traefik) GetWeights(application, serviceName string) (map[string]int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	weights := map[string]int{}
+	for _, b := range t.Backends[serviceKey(application, serviceName)] {
+		weights[slotOf(serviceName, b.Name)] = b.Weight
+	}
+	return weights, nil
+}
+
+func (t *Traefik) RemoveService(application, serviceName string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := serviceKey(application, serviceName)
+	delete(t.Routes, key)
+	delete(t.Certificates, key)
+	delete(t.Backends, key)
+	delete(t.Pointed, key)
+	return nil
+}
+
+func slotOf(serviceName, backend string) string {
+	fullName := strings.SplitN(backend, "@", 2)[0]
+	return strings.TrimPrefix(fullName, serviceName+"-")
+}
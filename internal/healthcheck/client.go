@@ -2,64 +2,137 @@ package healthcheck
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
 	"github.com/elissonalvesilva/releasy/pkg/httpclient"
-	"github.com/elissonalvesilva/releasy/pkg/logger"
 )
 
-type (
-	httpHealthChecker struct {
-		client *httpclient.Client
-	}
-
-	HealthChecker interface {
-		Ping(ctx context.Context, url string, port int, intervalSeconds int) error
-	}
-)
+type httpHealthChecker struct {
+	client *httpclient.Client
+}
 
 const (
-	uri = "http://%s:%d/ping"
+	uri         = "http://%s:%d%s"
+	defaultPath = "/ping"
+	maxBodySize = 1 << 20
 )
 
+// NewHTTPHealthChecker probes an HTTP endpoint of the instances.
 func NewHTTPHealthChecker(c *httpclient.Client) *httpHealthChecker {
 	return &httpHealthChecker{
 		client: c,
 	}
 }
 
-func (h *httpHealthChecker) Ping(ctx context.Context, serviceName string, port int, intervalSeconds int) error {
-	url := h.buildURL(serviceName, port)
-	logger.WithField("url", url).Info("starting healthcheck")
+// Probe sends one request as described by spec and checks its answer.
+func (h *httpHealthChecker) Probe(ctx context.Context, serviceName string, port int, spec dto.HealthCheck) error {
+	ctxProbe, cancel := withProbeTimeout(ctx, spec)
+	defer cancel()
 
-	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
-	defer ticker.Stop()
+	method := spec.Method
+	if method == "" {
+		method = http.MethodGet
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return fmt.Errorf("healthcheck canceled or timed out: %w", ctx.Err())
+	req, err := http.NewRequestWithContext(ctxProbe, method, h.buildURL(serviceName, port, spec), nil)
+	if err != nil {
+		return err
+	}
 
-		case <-ticker.C:
-			resp, err := h.client.Get(url)
-			if err != nil {
-				logger.Warn("Error pinging service, retrying...", err)
-				continue
-			}
-			resp.Body.Close()
+	for name, value := range spec.Headers {
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(name, value)
+	}
 
-			if resp.StatusCode == http.StatusOK {
-				logger.WithField("status", resp.StatusCode).Info("Ping OK! Service is healthy.")
-				return nil
-			}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
 
-			logger.WithField("status", resp.StatusCode).Warn("Ping returned unexpected status, retrying...")
+	if !expectedStatus(spec, resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	if spec.BodyContains == "" && spec.BodyJSONPath == "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+
+	if spec.BodyContains != "" && !strings.Contains(string(body), spec.BodyContains) {
+		return fmt.Errorf("body does not contain %q", spec.BodyContains)
+	}
+
+	if spec.BodyJSONPath != "" {
+		return matchJSONPath(body, spec.BodyJSONPath, spec.BodyJSONValue)
+	}
+
+	return nil
+}
+
+func expectedStatus(spec dto.HealthCheck, status int) bool {
+	if len(spec.ExpectedStatus) == 0 {
+		return status == http.StatusOK
+	}
+
+	for _, expected := range spec.ExpectedStatus {
+		if status == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// matchJSONPath checks that the body has a value at path, given as dot separated keys
+// and array indexes like $.checks.0.status, and that it equals value when one is set.
+func matchJSONPath(body []byte, path, value string) error {
+	var current interface{}
+	if err := json.Unmarshal(body, &current); err != nil {
+		return fmt.Errorf("body is not JSON: %w", err)
+	}
+
+	for _, key := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."), ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			next, ok := node[key]
+			if !ok {
+				return fmt.Errorf("body has no %s", path)
+			}
+			current = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return fmt.Errorf("body has no %s", path)
+			}
+			current = node[i]
+		default:
+			return fmt.Errorf("body has no %s", path)
 		}
 	}
+
+	if value != "" && fmt.Sprint(current) != value {
+		return fmt.Errorf("%s is %v, expected %s", path, current, value)
+	}
+	return nil
 }
 
-func (h *httpHealthChecker) buildURL(host string, port int) string {
-	return fmt.Sprintf(uri, host, port)
+func (h *httpHealthChecker) buildURL(host string, port int, spec dto.HealthCheck) string {
+	path := spec.Path
+	if path == "" {
+		path = defaultPath
+	}
+	return fmt.Sprintf(uri, host, port, path)
 }
@@ -0,0 +1,41 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+)
+
+type execHealthChecker struct {
+	docker docker.DockerClient
+}
+
+// NewExecHealthChecker runs the command of the check inside the containers of the
+// instance, which are healthy when it exits with 0.
+func NewExecHealthChecker(dockerClient docker.DockerClient) *execHealthChecker {
+	return &execHealthChecker{docker: dockerClient}
+}
+
+func (e *execHealthChecker) Probe(ctx context.Context, host string, _ int, spec dto.HealthCheck) error {
+	if len(spec.Command) == 0 {
+		return fmt.Errorf("exec health check of %s has no command", host)
+	}
+
+	ctxProbe, cancel := withProbeTimeout(ctx, spec)
+	defer cancel()
+
+	results, err := e.docker.Exec(ctxProbe, host, spec.Command)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%s exited with %d in %s: %s", spec.Command[0], result.ExitCode, result.Container, strings.TrimSpace(result.Output))
+		}
+	}
+	return nil
+}
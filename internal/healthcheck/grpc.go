@@ -0,0 +1,140 @@
+package healthcheck
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"golang.org/x/net/http2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type grpcHealthChecker struct {
+	client *http.Client
+}
+
+const (
+	grpcHealthURI = "http://%s:%d/grpc.health.v1.Health/Check"
+	grpcServing   = 1
+)
+
+var grpcServingStatus = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// NewGRPCHealthChecker calls grpc.health.v1.Health/Check over plaintext HTTP/2, the way
+// the instances are reached on the internal network.
+func NewGRPCHealthChecker() *grpcHealthChecker {
+	return &grpcHealthChecker{
+		client: &http.Client{
+			Transport: &http2.Transport{
+				AllowHTTP: true,
+				DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		},
+	}
+}
+
+// Probe asks the instance for the serving status of spec.GRPCService, or of the whole
+// server when it is empty.
+func (g *grpcHealthChecker) Probe(ctx context.Context, host string, port int, spec dto.HealthCheck) error {
+	ctxProbe, cancel := withProbeTimeout(ctx, spec)
+	defer cancel()
+
+	var message []byte
+	if spec.GRPCService != "" {
+		message = protowire.AppendTag(message, 1, protowire.BytesType)
+		message = protowire.AppendString(message, spec.GRPCService)
+	}
+
+	// A gRPC message is framed by a compression flag and its length.
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	frame = append(frame, message...)
+
+	req, err := http.NewRequestWithContext(ctxProbe, http.MethodPost, fmt.Sprintf(grpcHealthURI, host, port), bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return fmt.Errorf("read response: %w", err)
+	}
+
+	// An error without a message is sent in the headers alone.
+	status := resp.Trailer.Get("Grpc-Status")
+	if status == "" {
+		status = resp.Header.Get("Grpc-Status")
+	}
+	if status != "" && status != "0" {
+		return fmt.Errorf("grpc status %s: %s", status, resp.Trailer.Get("Grpc-Message")+resp.Header.Get("Grpc-Message"))
+	}
+
+	if len(body) < 5 {
+		return fmt.Errorf("empty health check response")
+	}
+
+	serving, err := parseServingStatus(body[5:])
+	if err != nil {
+		return err
+	}
+
+	if serving != grpcServing {
+		return fmt.Errorf("service is %s", grpcServingStatus[serving])
+	}
+	return nil
+}
+
+// parseServingStatus reads the status field of a HealthCheckResponse.
+func parseServingStatus(message []byte) (uint64, error) {
+	var status uint64
+	for len(message) > 0 {
+		num, typ, n := protowire.ConsumeTag(message)
+		if n < 0 {
+			return 0, fmt.Errorf("invalid health check response: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+
+		if num == 1 && typ == protowire.VarintType {
+			value, n := protowire.ConsumeVarint(message)
+			if n < 0 {
+				return 0, fmt.Errorf("invalid health check response: %w", protowire.ParseError(n))
+			}
+			status = value
+			message = message[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, message)
+		if n < 0 {
+			return 0, fmt.Errorf("invalid health check response: %w", protowire.ParseError(n))
+		}
+		message = message[n:]
+	}
+	return status, nil
+}
@@ -0,0 +1,345 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+)
+
+type (
+	// Observer is told about every attempt made by a checker whose context carries it.
+	Observer func(host string, attempt int, err error)
+
+	HealthChecker interface {
+		Ping(ctx context.Context, url string, port int, intervalSeconds int, spec dto.HealthCheck) error
+		Check(ctx context.Context, url string, port int, spec dto.HealthCheck) error
+		// PingSlot and CheckSlot probe every container of a slot on its own and pass
+		// when the quorum of the spec does.
+		PingSlot(ctx context.Context, serviceName, slot string, port int, intervalSeconds int, spec dto.HealthCheck) error
+		CheckSlot(ctx context.Context, serviceName, slot string, port int, spec dto.HealthCheck) error
+	}
+
+	// SlotResolver finds the containers of a slot, their addresses and their state.
+	SlotResolver interface {
+		ListBySlot(serviceName, slot string) ([]string, error)
+		ContainerIP(name string) (string, error)
+		ContainerState(name string) (docker.ContainerState, error)
+	}
+
+	// Prober runs a single attempt of one type of health check.
+	Prober interface {
+		Probe(ctx context.Context, host string, port int, spec dto.HealthCheck) error
+	}
+
+	// Dispatcher runs every health check with the prober of its type.
+	Dispatcher struct {
+		probers  map[string]Prober
+		resolver SlotResolver
+	}
+
+	// replica is a container of a slot and the address it is probed on.
+	replica struct {
+		name    string
+		address string
+	}
+)
+
+type observerKey struct{}
+
+// ErrContainerDown is returned as soon as a probed container exits, restarts or is
+// reported unhealthy by Docker, since its probes will not pass anymore.
+var ErrContainerDown = errors.New("container is down")
+
+const defaultTimeout = 5 * time.Second
+
+// WithObserver returns a context that reports the health check attempts made with it.
+func WithObserver(ctx context.Context, observer Observer) context.Context {
+	return context.WithValue(ctx, observerKey{}, observer)
+}
+
+func notify(ctx context.Context, host string, attempt int, err error) {
+	if observer, ok := ctx.Value(observerKey{}).(Observer); ok {
+		observer(host, attempt, err)
+	}
+}
+
+// NewDispatcher creates a checker running each health check with the prober registered
+// for its type. A check without a type is an HTTP check.
+func NewDispatcher(probers map[string]Prober, resolver SlotResolver) *Dispatcher {
+	return &Dispatcher{probers: probers, resolver: resolver}
+}
+
+// Ping probes the container every interval, on its own address, until it passes
+// SuccessThreshold probes in a row, fails FailureThreshold in a row, or ctx is done.
+func (d *Dispatcher) Ping(ctx context.Context, serviceName string, port int, intervalSeconds int, spec dto.HealthCheck) error {
+	prober, err := d.prober(spec)
+	if err != nil {
+		return err
+	}
+	logger.WithField("host", serviceName).Info(fmt.Sprintf("starting %s healthcheck", checkType(spec)))
+
+	return d.ping(ctx, prober, d.replica(serviceName, spec), port, intervalSeconds, spec)
+}
+
+// Check runs a single probe against the container, on its own address, without retrying.
+func (d *Dispatcher) Check(ctx context.Context, serviceName string, port int, spec dto.HealthCheck) error {
+	prober, err := d.prober(spec)
+	if err != nil {
+		return err
+	}
+
+	err = prober.Probe(ctx, d.replica(serviceName, spec).address, port, spec)
+	notify(ctx, serviceName, 1, err)
+	return err
+}
+
+// PingSlot pings every container of the slot at the same time and returns once enough
+// of them are healthy for the quorum, or too many failed to ever reach it.
+func (d *Dispatcher) PingSlot(ctx context.Context, serviceName, slot string, port int, intervalSeconds int, spec dto.HealthCheck) error {
+	prober, err := d.prober(spec)
+	if err != nil {
+		return err
+	}
+
+	replicas, err := d.replicas(serviceName, slot, spec)
+	if err != nil {
+		return err
+	}
+
+	required := quorum(len(replicas), spec)
+	logger.WithField("slot", serviceName+"-"+slot).Info(fmt.Sprintf("starting %s healthcheck of %d containers, %d must pass", checkType(spec), len(replicas), required))
+
+	ctxPing, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan error, len(replicas))
+	for _, r := range replicas {
+		go func(r replica) {
+			results <- d.ping(ctxPing, prober, r, port, intervalSeconds, spec)
+		}(r)
+	}
+
+	return awaitQuorum(results, len(replicas), required)
+}
+
+// CheckSlot probes every container of the slot once, and passes when the quorum does.
+func (d *Dispatcher) CheckSlot(ctx context.Context, serviceName, slot string, port int, spec dto.HealthCheck) error {
+	prober, err := d.prober(spec)
+	if err != nil {
+		return err
+	}
+
+	replicas, err := d.replicas(serviceName, slot, spec)
+	if err != nil {
+		return err
+	}
+
+	results := make(chan error, len(replicas))
+	for _, r := range replicas {
+		go func(r replica) {
+			err := prober.Probe(ctx, r.address, port, spec)
+			if err == nil {
+				if ready, stateErr := d.containerReady(r.name); stateErr != nil {
+					err = stateErr
+				} else if !ready {
+					err = fmt.Errorf("%s is not healthy yet", r.name)
+				}
+			}
+			notify(ctx, r.name, 1, err)
+			if err != nil {
+				err = fmt.Errorf("%s: %w", r.name, err)
+			}
+			results <- err
+		}(r)
+	}
+
+	return awaitQuorum(results, len(replicas), quorum(len(replicas), spec))
+}
+
+// replicas lists the containers of a slot. Network checks reach each one on its own
+// address, since the alias of the slot lands on any of them.
+func (d *Dispatcher) replicas(serviceName, slot string, spec dto.HealthCheck) ([]replica, error) {
+	names, err := d.resolver.ListBySlot(serviceName, slot)
+	if err != nil {
+		return nil, fmt.Errorf("list containers: %w", err)
+	}
+
+	var replicas []replica
+	for _, name := range names {
+		name = strings.TrimPrefix(name, "/")
+		if !docker.InSlot(name, serviceName, slot) {
+			continue
+		}
+
+		replicas = append(replicas, d.replica(name, spec))
+	}
+
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no container found for %s-%s", serviceName, slot)
+	}
+	return replicas, nil
+}
+
+// replica is the container named name, reached on its IP by network checks so that a
+// name shared through an alias cannot land on another container. A container without
+// an address is probed by name and fails like any other.
+func (d *Dispatcher) replica(name string, spec dto.HealthCheck) replica {
+	r := replica{name: name, address: name}
+	if d.resolver == nil || checkType(spec) == domain.HealthCheckExec {
+		return r
+	}
+
+	if ip, err := d.resolver.ContainerIP(name); err == nil {
+		r.address = ip
+	} else {
+		logger.WithError(err).Warn(fmt.Sprintf("no address for %s", name))
+	}
+	return r
+}
+
+// ping probes one instance every interval until it passes SuccessThreshold probes in a
+// row, fails FailureThreshold in a row, stops running, or ctx is done. A probe only
+// counts as a success once Docker reports the container healthy as well. An interval
+// that is not positive falls back to the default one.
+func (d *Dispatcher) ping(ctx context.Context, prober Prober, r replica, port int, intervalSeconds int, spec dto.HealthCheck) error {
+	if intervalSeconds <= 0 {
+		intervalSeconds = domain.DefaultHealthCheckIntervalSeconds
+	}
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	successThreshold := max(spec.SuccessThreshold, 1)
+	attempt, successes, failures := 0, 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("healthcheck of %s canceled or timed out: %w", r.name, ctx.Err())
+
+		case <-ticker.C:
+			attempt++
+			ready, err := d.containerReady(r.name)
+			if err != nil {
+				notify(ctx, r.name, attempt, err)
+				return err
+			}
+
+			err = prober.Probe(ctx, r.address, port, spec)
+			if err == nil && !ready {
+				// Docker still runs the health check of the image, wait for its verdict.
+				notify(ctx, r.name, attempt, fmt.Errorf("%s is not healthy yet", r.name))
+				successes = 0
+				continue
+			}
+
+			notify(ctx, r.name, attempt, err)
+			if err != nil {
+				successes = 0
+				failures++
+				logger.WithError(err).Warn(fmt.Sprintf("Healthcheck of %s failed, retrying...", r.name))
+				if spec.FailureThreshold > 0 && failures >= spec.FailureThreshold {
+					return fmt.Errorf("healthcheck of %s failed %d times in a row: %w", r.name, failures, err)
+				}
+				continue
+			}
+
+			failures = 0
+			successes++
+			if successes >= successThreshold {
+				logger.WithField("host", r.name).Info("Ping OK! Service is healthy.")
+				return nil
+			}
+		}
+	}
+}
+
+// containerReady asks Docker about the container. It fails when the container stopped
+// or restarted, and is not ready while its own health check has not passed yet. A
+// container Docker cannot tell about is left to the probes.
+func (d *Dispatcher) containerReady(name string) (bool, error) {
+	if d.resolver == nil {
+		return true, nil
+	}
+
+	state, err := d.resolver.ContainerState(name)
+	if err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("no state for %s", name))
+		return true, nil
+	}
+
+	switch {
+	case state.Status == "exited" || state.Status == "dead":
+		return false, fmt.Errorf("%w: %s is %s with exit code %d", ErrContainerDown, name, state.Status, state.ExitCode)
+	case state.Status == "restarting":
+		return false, fmt.Errorf("%w: %s is restarting", ErrContainerDown, name)
+	case state.RestartCount > 0:
+		return false, fmt.Errorf("%w: %s restarted %d times", ErrContainerDown, name, state.RestartCount)
+	case state.Health == "unhealthy":
+		return false, fmt.Errorf("%w: %s is unhealthy", ErrContainerDown, name)
+	case state.Health == "starting":
+		return false, nil
+	default:
+		return true, nil
+	}
+}
+
+// awaitQuorum collects the results of total replicas until required of them passed,
+// or until so many failed that the quorum cannot be reached anymore.
+func awaitQuorum(results <-chan error, total, required int) error {
+	passed, failed := 0, 0
+	var errs []error
+	for passed < required {
+		err := <-results
+		if err == nil {
+			passed++
+			continue
+		}
+
+		failed++
+		errs = append(errs, err)
+		if total-failed < required {
+			return fmt.Errorf("%d of %d containers healthy, %d required: %w", passed, total, required, errors.Join(errs...))
+		}
+	}
+	return nil
+}
+
+// quorum is the number of replicas out of total that must pass, all of them unless the
+// spec asks for a percentage.
+func quorum(total int, spec dto.HealthCheck) int {
+	if spec.QuorumPercent <= 0 || spec.QuorumPercent >= 100 {
+		return total
+	}
+	return max((total*spec.QuorumPercent+99)/100, 1)
+}
+
+func (d *Dispatcher) prober(spec dto.HealthCheck) (Prober, error) {
+	prober, ok := d.probers[checkType(spec)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported health check type %q", spec.Type)
+	}
+	return prober, nil
+}
+
+func checkType(spec dto.HealthCheck) string {
+	if spec.Type == "" {
+		return domain.HealthCheckHTTP
+	}
+	return spec.Type
+}
+
+// withProbeTimeout bounds a single attempt by the timeout of the spec.
+func withProbeTimeout(ctx context.Context, spec dto.HealthCheck) (context.Context, context.CancelFunc) {
+	timeout := defaultTimeout
+	if spec.TimeoutSeconds > 0 {
+		timeout = time.Duration(spec.TimeoutSeconds) * time.Second
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,175 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+)
+
+// fakeProber fails the probes of the addresses in failing.
+type fakeProber struct {
+	failing map[string]bool
+}
+
+func (p fakeProber) Probe(_ context.Context, host string, _ int, _ dto.HealthCheck) error {
+	if p.failing[host] {
+		return errors.New("probe failed")
+	}
+	return nil
+}
+
+// fakeResolver reaches every container at ip-<name>.
+type fakeResolver struct {
+	names  []string
+	states map[string]docker.ContainerState
+}
+
+func (r fakeResolver) ListBySlot(_, _ string) ([]string, error) {
+	return r.names, nil
+}
+
+func (r fakeResolver) ContainerIP(name string) (string, error) {
+	return "ip-" + name, nil
+}
+
+func (r fakeResolver) ContainerState(name string) (docker.ContainerState, error) {
+	if state, ok := r.states[name]; ok {
+		return state, nil
+	}
+	return docker.ContainerState{Status: "running"}, nil
+}
+
+func TestDispatcherCheckSlot(t *testing.T) {
+	replicas := []string{"/api-v1-1", "/api-v1-2", "/api-v1-3"}
+
+	tests := []struct {
+		name     string
+		names    []string
+		failing  []string
+		states   map[string]docker.ContainerState
+		spec     dto.HealthCheck
+		wantErr  bool
+		wantDown bool
+	}{
+		{name: "all healthy", names: replicas},
+		{name: "one failing without quorum", names: replicas, failing: []string{"ip-api-v1-2"}, wantErr: true},
+		{
+			name:    "one failing within quorum",
+			names:   replicas,
+			failing: []string{"ip-api-v1-2"},
+			spec:    dto.HealthCheck{QuorumPercent: 60},
+		},
+		{
+			name:    "two failing beyond quorum",
+			names:   replicas,
+			failing: []string{"ip-api-v1-1", "ip-api-v1-2"},
+			spec:    dto.HealthCheck{QuorumPercent: 60},
+			wantErr: true,
+		},
+		{
+			name:     "exited container",
+			names:    replicas,
+			states:   map[string]docker.ContainerState{"api-v1-3": {Status: "exited", ExitCode: 1}},
+			wantErr:  true,
+			wantDown: true,
+		},
+		{
+			name:    "docker health check still starting",
+			names:   replicas,
+			states:  map[string]docker.ContainerState{"api-v1-1": {Status: "running", Health: "starting"}},
+			wantErr: true,
+		},
+		{
+			name:    "revision of the slot is not probed",
+			names:   []string{"/api-v1-1", "/api-v1-r1-1"},
+			failing: []string{"ip-api-v1-r1-1"},
+		},
+		{name: "no container", names: []string{"/api-v1-r1-1"}, wantErr: true},
+		{name: "unsupported type", names: replicas, spec: dto.HealthCheck{Type: "smtp"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing := map[string]bool{}
+			for _, address := range tt.failing {
+				failing[address] = true
+			}
+			d := NewDispatcher(
+				map[string]Prober{domain.HealthCheckHTTP: fakeProber{failing: failing}},
+				fakeResolver{names: tt.names, states: tt.states},
+			)
+
+			err := d.CheckSlot(context.Background(), "api", "v1", 80, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckSlot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if down := errors.Is(err, ErrContainerDown); down != tt.wantDown {
+				t.Errorf("CheckSlot() error = %v, want ErrContainerDown %v", err, tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestDispatcherCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		failing string
+		spec    dto.HealthCheck
+		wantErr bool
+	}{
+		{name: "network check on the container address", failing: "ip-api-v1-1", wantErr: true},
+		{name: "network check not on the container name", failing: "api-v1-1"},
+		{name: "exec check on the container name", failing: "api-v1-1", spec: dto.HealthCheck{Type: domain.HealthCheckExec}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := fakeProber{failing: map[string]bool{tt.failing: true}}
+			d := NewDispatcher(
+				map[string]Prober{domain.HealthCheckHTTP: prober, domain.HealthCheckExec: prober},
+				fakeResolver{},
+			)
+
+			err := d.Check(context.Background(), "api-v1-1", 80, tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatcherPingWithoutInterval(t *testing.T) {
+	d := NewDispatcher(map[string]Prober{domain.HealthCheckHTTP: fakeProber{}}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := d.Ping(ctx, "api-v1", 80, 0, dto.HealthCheck{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Ping() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestQuorum(t *testing.T) {
+	tests := []struct {
+		total   int
+		percent int
+		want    int
+	}{
+		{total: 3, percent: 0, want: 3},
+		{total: 3, percent: 100, want: 3},
+		{total: 3, percent: 50, want: 2},
+		{total: 4, percent: 50, want: 2},
+		{total: 1, percent: 10, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := quorum(tt.total, dto.HealthCheck{QuorumPercent: tt.percent}); got != tt.want {
+			t.Errorf("quorum(%d, %d%%) = %d, want %d", tt.total, tt.percent, got, tt.want)
+		}
+	}
+}
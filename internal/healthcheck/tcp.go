@@ -0,0 +1,30 @@
+package healthcheck
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+)
+
+type tcpHealthChecker struct {
+	dialer net.Dialer
+}
+
+// NewTCPHealthChecker considers an instance healthy once it accepts connections on its port.
+func NewTCPHealthChecker() *tcpHealthChecker {
+	return &tcpHealthChecker{}
+}
+
+func (t *tcpHealthChecker) Probe(ctx context.Context, host string, port int, spec dto.HealthCheck) error {
+	ctxProbe, cancel := withProbeTimeout(ctx, spec)
+	defer cancel()
+
+	conn, err := t.dialer.DialContext(ctxProbe, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	return conn.Close()
+}
@@ -0,0 +1,222 @@
+package allin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/convert"
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/release"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/elissonalvesilva/releasy/pkg/utils"
+)
+
+type Handler struct {
+	DockerClient  docker.DockerClient
+	TraefikClient traefik.TraefikInterface
+	HealthChecker healthcheck.HealthChecker
+	db            store.DbStore
+	progress      *progress.Reporter
+}
+
+func New(
+	dockerClient docker.DockerClient,
+	traefikClient traefik.TraefikInterface,
+	healthChecker healthcheck.HealthChecker,
+	db store.DbStore,
+	reporter *progress.Reporter,
+) *Handler {
+	return &Handler{
+		DockerClient:  dockerClient,
+		TraefikClient: traefikClient,
+		HealthChecker: healthChecker,
+		db:            db,
+		progress:      reporter,
+	}
+}
+
+func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Action {
+	case domain.ActionDeployCreate:
+		return h.executeAllIn(ctx, deploy)
+	default:
+		return fmt.Errorf("invalid action: %s", deploy.Action)
+	}
+}
+
+// Resume picks up an all-in rollout interrupted at the step it had recorded.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Step {
+	case domain.StepCreating, domain.StepCreatingInfra:
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+			return fmt.Errorf("remove partial slot: %w", err)
+		}
+		return h.Run(ctx, deploy)
+	case domain.StepSwapTraffic:
+		service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+		if err != nil {
+			return fmt.Errorf("get service: %w", err)
+		}
+
+		if service.Version == deploy.Version {
+			return h.updateDeploymentStep(ctx, deploy, domain.StepFinished)
+		}
+
+		port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
+		if err := h.HealthChecker.CheckSlot(ctx, deploy.ServiceName, deploy.Version, port, deploy.HealthCheck); err != nil {
+			return h.restore(ctx, deploy, service.Version, fmt.Errorf("candidate unhealthy after restart: %w", err))
+		}
+		return h.swap(ctx, deploy, service, service.Version)
+	default:
+		return fmt.Errorf("cannot resume deployment %s from step %s", deploy.ID, deploy.Step)
+	}
+}
+
+func (h *Handler) executeAllIn(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	if service.Version == deploy.Version {
+		return fmt.Errorf("version %s is already running for %s", deploy.Version, deploy.ServiceName)
+	}
+
+	oldSlot := service.Version
+	envs := utils.ParseEnvString(deploy.Envs)
+	port := utils.ExtractPort(envs)
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepCreatingInfra); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	pulled, err := h.DockerClient.EnsureImage(deploy.Image)
+	if err != nil {
+		return h.fail(ctx, deploy, fmt.Errorf("ensure image: %w", err))
+	}
+	h.progress.ImageReady(ctx, deploy, pulled)
+
+	names, err := h.DockerClient.CreateService(
+		deploy.ServiceName,
+		deploy.Version,
+		deploy.Image,
+		uint64(deploy.Replicas),
+		envs,
+		port,
+		convert.ToDockerHealthCheck(deploy.DockerHealthCheck),
+	)
+	if err != nil {
+		return h.fail(ctx, deploy, fmt.Errorf("create slot: %w", err))
+	}
+	h.progress.ContainersStarted(ctx, deploy, names...)
+
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
+		return h.fail(ctx, deploy, fmt.Errorf("ensure router: %w", err))
+	}
+
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
+	defer cancel()
+
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	if err := h.HealthChecker.PingSlot(ctxPing, deploy.ServiceName, deploy.Version, port, interval, deploy.HealthCheck); err != nil {
+		return h.fail(ctx, deploy, fmt.Errorf("healthcheck failed: %w", err))
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepSwapTraffic); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	return h.swap(ctx, deploy, service, oldSlot)
+}
+
+// swap sends all of the traffic to the candidate and removes oldSlot. Every call it
+// makes can be repeated, so it is also how an interrupted swap is completed.
+func (h *Handler) swap(ctx context.Context, deploy *dto.Deployment, service *dto.Service, oldSlot string) error {
+	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
+
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: slotName, Weight: 100},
+	}); err != nil {
+		return fmt.Errorf("insert weighted: %w", err)
+	}
+
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, deploy.Version); err != nil {
+		logger.Warn(fmt.Sprintf("[AllIn] Failed to point router: %v", err))
+		return fmt.Errorf("point router failed: %w", err)
+	}
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, oldSlot); err != nil {
+		logger.Warn(fmt.Sprintf("[AllIn] Failed to remove old slot: %v", err))
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, oldSlot)
+	}
+
+	release.Apply(service, deploy)
+
+	if err := h.db.UpdateService(ctx, *service); err != nil {
+		logger.WithError(err).Error("error on update service")
+		return fmt.Errorf("error update service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinished); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[AllIn] Rollout finished for %s", deploy.ServiceName))
+	return nil
+}
+
+// fail removes the candidate slot, which never received traffic, and marks the deployment as failed.
+func (h *Handler) fail(ctx context.Context, deploy *dto.Deployment, cause error) error {
+	logger.WithError(cause).Error(fmt.Sprintf("[AllIn] Rollout of %s failed", deploy.ServiceName))
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+		logger.WithError(err).Error("[AllIn] Failed to remove candidate slot")
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, deploy.Version)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFailed); err != nil {
+		logger.WithError(err).Error("update deployment step")
+	}
+
+	return cause
+}
+
+// restore gives the traffic back to oldSlot, which may have lost it during the swap,
+// before the candidate is removed.
+func (h *Handler) restore(ctx context.Context, deploy *dto.Deployment, oldSlot string, cause error) error {
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: deploy.ServiceName + "-" + oldSlot, Weight: 100},
+	}); err != nil {
+		logger.WithError(err).Error("[AllIn] Failed to restore weights")
+	}
+
+	return h.fail(ctx, deploy, cause)
+}
+
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
+}
+
+func (h *Handler) setWeights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) error {
+	if err := h.TraefikClient.InsertWeightedService(deploy.Application, deploy.ServiceName, backends); err != nil {
+		return err
+	}
+
+	h.progress.Weights(ctx, deploy, backends)
+	return nil
+}
@@ -0,0 +1,172 @@
+package allin
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+)
+
+type testEnv struct {
+	db      *fakes.Store
+	docker  *fakes.Docker
+	traefik *fakes.Traefik
+	health  *fakes.HealthChecker
+}
+
+// newTestEnv runs v1 of shop/api on two replicas, receiving all of the traffic.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		db:      fakes.NewStore(),
+		docker:  fakes.NewDocker(),
+		traefik: fakes.NewTraefik(),
+		health:  fakes.NewHealthChecker(),
+	}
+	env.db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v1", Image: "api:v1", Replicas: 2})
+	env.docker.AddSlot("api", "v1", 2)
+	if err := env.traefik.EnsureRouter("shop", "api", traefik.ServiceRoutes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.traefik.InsertWeightedService("shop", "api", []traefik.WeightedBackend{{Name: "api-v1", Weight: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func TestHandlerResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        string
+		setup       func(env *testEnv)
+		wantErr     bool
+		wantStep    string
+		wantVersion string
+		wantWeights map[string]int
+		wantSlots   map[string]int
+	}{
+		{
+			name: "creating starts over",
+			step: domain.StepCreatingInfra,
+			setup: func(env *testEnv) {
+				env.docker.AddSlot("api", "v2", 1)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v2": 100},
+			wantSlots:   map[string]int{"v1": 0, "v2": 2},
+		},
+		{
+			name: "creating with an unhealthy candidate",
+			step: domain.StepCreating,
+			setup: func(env *testEnv) {
+				env.health.SetUnhealthy("api-v2", true)
+			},
+			wantErr:     true,
+			wantStep:    domain.StepFailed,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 0},
+		},
+		{
+			name: "swap completed",
+			step: domain.StepSwapTraffic,
+			setup: func(env *testEnv) {
+				env.docker.AddSlot("api", "v2", 2)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v2": 100},
+			wantSlots:   map[string]int{"v1": 0, "v2": 2},
+		},
+		{
+			name: "swap already recorded on the service",
+			step: domain.StepSwapTraffic,
+			setup: func(env *testEnv) {
+				env.db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v2", Image: "api:v2", Replicas: 2})
+				env.docker.AddSlot("api", "v2", 2)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 2},
+		},
+		{
+			name: "swap with an unhealthy candidate",
+			step: domain.StepSwapTraffic,
+			setup: func(env *testEnv) {
+				env.docker.AddSlot("api", "v2", 2)
+				env.health.SetUnhealthy("api-v2", true)
+			},
+			wantErr:     true,
+			wantStep:    domain.StepFailed,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 0},
+		},
+		{
+			name:        "unknown step",
+			step:        domain.StepEffective,
+			wantErr:     true,
+			wantStep:    domain.StepEffective,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			if tt.setup != nil {
+				tt.setup(env)
+			}
+
+			deploy := &dto.Deployment{
+				ID:                 "d1",
+				Application:        "shop",
+				ServiceName:        "api",
+				DeploymentStrategy: domain.StrategyAllIn,
+				Version:            "v2",
+				Image:              "api:v2",
+				Replicas:           2,
+				Action:             domain.ActionDeployCreate,
+				Step:               tt.step,
+			}
+			if err := env.db.SaveDeployment(context.Background(), *deploy); err != nil {
+				t.Fatal(err)
+			}
+
+			h := New(env.docker, env.traefik, env.health, env.db, progress.New(env.db, fakes.NewStreams()))
+			err := h.Resume(context.Background(), deploy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := env.db.Step("d1"); got != tt.wantStep {
+				t.Errorf("step = %q, want %q", got, tt.wantStep)
+			}
+			service, err := env.db.GetService(context.Background(), "shop", "api")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if service.Version != tt.wantVersion {
+				t.Errorf("service version = %q, want %q", service.Version, tt.wantVersion)
+			}
+			if weights, _ := env.traefik.GetWeights("shop", "api"); !maps.Equal(weights, tt.wantWeights) {
+				t.Errorf("weights = %v, want %v", weights, tt.wantWeights)
+			}
+			for slot, want := range tt.wantSlots {
+				if got := len(env.docker.Slot("api", slot)); got != want {
+					t.Errorf("slot %s runs %d containers, want %d", slot, got, want)
+				}
+			}
+		})
+	}
+}
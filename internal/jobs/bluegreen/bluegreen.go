@@ -2,39 +2,48 @@ package bluegreen
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"github.com/elissonalvesilva/releasy/internal/core/domain"
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/release"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
 	"github.com/elissonalvesilva/releasy/internal/store"
-	"strconv"
-	"strings"
 	"time"
 
+	"github.com/elissonalvesilva/releasy/internal/convert"
 	"github.com/elissonalvesilva/releasy/internal/docker"
 	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/guard"
 	"github.com/elissonalvesilva/releasy/internal/traefik"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/elissonalvesilva/releasy/pkg/utils"
 )
 
 type Handler struct {
 	DockerClient  docker.DockerClient
 	TraefikClient traefik.TraefikInterface
 	HealthChecker healthcheck.HealthChecker
+	Guard         *guard.Guard
 	db            store.DbStore
+	progress      *progress.Reporter
 }
 
 func New(
 	dockerClient docker.DockerClient,
 	traefikClient traefik.TraefikInterface,
 	healthChecker healthcheck.HealthChecker,
+	guard *guard.Guard,
 	db store.DbStore,
+	reporter *progress.Reporter,
 ) *Handler {
 	return &Handler{
 		DockerClient:  dockerClient,
 		TraefikClient: traefikClient,
 		HealthChecker: healthChecker,
+		Guard:         guard,
 		db:            db,
+		progress:      reporter,
 	}
 }
 
@@ -52,43 +61,126 @@ func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
 	}
 }
 
+// Resume picks up a deployment interrupted at the step it had recorded.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Step {
+	case domain.StepCreating, domain.StepCreatingInfra:
+		// The candidate never received traffic, so it is created again from scratch.
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+			return fmt.Errorf("remove partial slot: %w", err)
+		}
+		return h.Run(ctx, deploy)
+	case domain.StepSwapTraffic, domain.StepPaused, domain.StepAwaitingPromotion:
+		return h.resumeSwap(ctx, deploy)
+	case domain.StepEffective:
+		if deploy.Action != domain.ActionDeployCreate {
+			return h.Run(ctx, deploy)
+		}
+
+		if deploy.AutoFinishAfter > 0 {
+			service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+			if err != nil {
+				return fmt.Errorf("get service: %w", err)
+			}
+			return h.bake(ctx, deploy, service.Version)
+		}
+
+		logger.Info(fmt.Sprintf("[BlueGreen] Deployment %s is effective and waiting to be finished", deploy.ID))
+		return nil
+	case domain.StepFinishing:
+		return h.executeFinishBlueGreen(ctx, deploy)
+	case domain.StepRollBacking:
+		if deploy.Action == domain.ActionDeployRollback {
+			return h.executeRollback(ctx, deploy)
+		}
+
+		service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+		if err != nil {
+			return fmt.Errorf("get service: %w", err)
+		}
+		return h.autoRollback(ctx, deploy, service.Version, domain.ErrDeploymentInterrupted)
+	default:
+		return fmt.Errorf("cannot resume deployment %s from step %s", deploy.ID, deploy.Step)
+	}
+}
+
+// resumeSwap carries on shifting traffic from the weight the candidate had reached when
+// it is still healthy, and rolls back to the stable slot otherwise.
+func (h *Handler) resumeSwap(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		return fmt.Errorf("get service: %w", err)
+	}
+	oldSlot := service.Version
+
+	weights, err := h.TraefikClient.GetWeights(deploy.Application, deploy.ServiceName)
+	if err != nil {
+		return h.autoRollback(ctx, deploy, oldSlot, fmt.Errorf("read weights: %w", err))
+	}
+
+	names, err := h.DockerClient.ListBySlot(deploy.ServiceName, deploy.Version)
+	if err != nil || len(names) == 0 {
+		return h.autoRollback(ctx, deploy, oldSlot, fmt.Errorf("candidate slot is gone: %w", domain.ErrDeploymentInterrupted))
+	}
+
+	if err := h.HealthChecker.CheckSlot(ctx, deploy.ServiceName, deploy.Version, utils.ExtractPort(utils.ParseEnvString(deploy.Envs)), deploy.HealthCheck); err != nil {
+		return h.autoRollback(ctx, deploy, oldSlot, fmt.Errorf("candidate unhealthy after restart: %w", err))
+	}
+
+	newWeight := max(weights[deploy.Version], 20)
+	logger.Info(fmt.Sprintf("[BlueGreen] Resuming %s at candidate weight %d", deploy.ID, newWeight))
+	return h.shiftTraffic(ctx, deploy, oldSlot, newWeight)
+}
+
 func (h *Handler) executeCreateBlueGreen(ctx context.Context, deploy *dto.Deployment) error {
-	port := extractPort(parseEnvString(deploy.Envs))
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
 
 	if err := h.updateDeploymentStep(ctx, deploy, domain.StepCreatingInfra); err != nil {
 		logger.WithError(err).Error("update deployment step")
 		return fmt.Errorf("update deployment step: %w", err)
 	}
 
-	if err := h.DockerClient.CreateService(
+	pulled, err := h.DockerClient.EnsureImage(deploy.Image)
+	if err != nil {
+		return fmt.Errorf("ensure image: %w", err)
+	}
+	h.progress.ImageReady(ctx, deploy, pulled)
+
+	names, err := h.DockerClient.CreateService(
 		deploy.ServiceName,
 		deploy.Version,
 		deploy.Image,
 		uint64(deploy.Replicas),
-		parseEnvString(deploy.Envs),
+		utils.ParseEnvString(deploy.Envs),
 		port,
-		false,
-	); err != nil {
+		convert.ToDockerHealthCheck(deploy.DockerHealthCheck),
+	)
+	if err != nil {
 		return fmt.Errorf("create slot: %w", err)
 	}
+	h.progress.ContainersStarted(ctx, deploy, names...)
 
-	if err := h.TraefikClient.EnsureRouter(
-		deploy.ServiceName,
-		fmt.Sprintf("Host(`%s.local`)", deploy.ServiceName),
-	); err != nil {
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
 		return fmt.Errorf("ensure router: %w", err)
 	}
 
-	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(deploy.MaxWaitTime)*time.Second)
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
 	defer cancel()
 
-	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
-	if err := h.HealthChecker.Ping(ctxPing, slotName, port, deploy.HealthCheckInterval); err != nil {
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	if err := h.HealthChecker.PingSlot(ctxPing, deploy.ServiceName, deploy.Version, port, interval, deploy.HealthCheck); err != nil {
 		_ = h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version)
 		return fmt.Errorf("healthcheck failed: %w", err)
 	}
 
-	oldSlot, err := h.TraefikClient.GetCurrentSlot(deploy.ServiceName)
+	oldSlot, err := h.TraefikClient.GetCurrentSlot(deploy.Application, deploy.ServiceName)
 	if err != nil {
 		return fmt.Errorf("get current slot: %w", err)
 	}
@@ -99,26 +191,44 @@ func (h *Handler) executeCreateBlueGreen(ctx context.Context, deploy *dto.Deploy
 		return fmt.Errorf("update deployment step: %w", err)
 	}
 
-	if err := h.TraefikClient.InsertWeightedService(deploy.ServiceName, []traefik.WeightedBackend{
-		{Name: deploy.ServiceName + "-" + oldSlot, Weight: 80},
-		{Name: slotName, Weight: 20},
+	return h.shiftTraffic(ctx, deploy, oldSlot, 20)
+}
+
+// shiftTraffic moves the traffic from oldSlot to the candidate by steps of 20%, starting
+// with newWeight for the candidate, and leaves the deployment effective. Each step can
+// be held by a pause or, for a manual deployment, until it is promoted.
+func (h *Handler) shiftTraffic(ctx context.Context, deploy *dto.Deployment, oldSlot string, newWeight int) error {
+	port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
+	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
+	oldWeight := 100 - newWeight
+
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: deploy.ServiceName + "-" + oldSlot, Weight: oldWeight},
+		{Name: slotName, Weight: newWeight},
 	}); err != nil {
 		return fmt.Errorf("insert weighted: %w", err)
 	}
 
-	oldWeight := 80
-	newWeight := 20
+	watch := h.Guard.Watch(deploy.ServiceName, deploy.Version, port, deploy.HealthCheck, deploy.MaxErrorRate, utils.GetIntOrDefault(deploy.FailureThreshold, domain.DefaultFailureThreshold))
+	checkInterval := time.Duration(utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)) * time.Second
 
 	logger.Info(fmt.Sprintf("[BlueGreen] Candidate weight is %d and Current is %d", newWeight, oldWeight))
 	for oldWeight > 0 {
-		time.Sleep(time.Duration(deploy.SwapInterval) * time.Second)
+		if err := watch.Observe(ctx, time.Duration(deploy.SwapInterval)*time.Second, checkInterval); err != nil {
+			return h.autoRollback(ctx, deploy, oldSlot, err)
+		}
+
+		if err := h.progress.Hold(ctx, deploy); err != nil {
+			return h.autoRollback(ctx, deploy, oldSlot, err)
+		}
+
 		oldWeight -= 20
 		if oldWeight < 0 {
 			oldWeight = 0
 		}
 		newWeight = 100 - oldWeight
 
-		if err := h.TraefikClient.InsertWeightedService(deploy.ServiceName, []traefik.WeightedBackend{
+		if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
 			{Name: deploy.ServiceName + "-" + oldSlot, Weight: oldWeight},
 			{Name: slotName, Weight: newWeight},
 		}); err != nil {
@@ -134,14 +244,35 @@ func (h *Handler) executeCreateBlueGreen(ctx context.Context, deploy *dto.Deploy
 
 	logger.Info(fmt.Sprintf("[BlueGreen] Deployment effective for %s and deployment_id: %s", deploy.ServiceName, deploy.ID))
 
+	if deploy.AutoFinishAfter > 0 {
+		return h.bake(ctx, deploy, oldSlot)
+	}
+
 	return nil
 }
 
+// bake keeps watching the candidate for AutoFinishAfter once it receives all of the
+// traffic, then finishes the deployment, or rolls back to oldSlot when it turns unhealthy.
+func (h *Handler) bake(ctx context.Context, deploy *dto.Deployment, oldSlot string) error {
+	port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
+	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
+
+	watch := h.Guard.Watch(deploy.ServiceName, deploy.Version, port, deploy.HealthCheck, deploy.MaxErrorRate, utils.GetIntOrDefault(deploy.FailureThreshold, domain.DefaultFailureThreshold))
+	checkInterval := time.Duration(utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)) * time.Second
+
+	logger.Info(fmt.Sprintf("[BlueGreen] Baking %s for %ds before finishing", slotName, deploy.AutoFinishAfter))
+	if err := watch.Observe(ctx, time.Duration(deploy.AutoFinishAfter)*time.Second, checkInterval); err != nil {
+		return h.autoRollback(ctx, deploy, oldSlot, err)
+	}
+
+	return h.executeFinishBlueGreen(ctx, deploy)
+}
+
 func (h *Handler) executeFinishBlueGreen(ctx context.Context, deploy *dto.Deployment) error {
-	service, err := h.db.GetServiceByName(ctx, deploy.ServiceName)
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
 	if err != nil {
-		logger.WithError(err).Error("error on get service by name")
-		return fmt.Errorf("error get service by name: %w", err)
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
 	}
 
 	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinishing); err != nil {
@@ -149,31 +280,32 @@ func (h *Handler) executeFinishBlueGreen(ctx context.Context, deploy *dto.Deploy
 		return fmt.Errorf("update deployment step: %w", err)
 	}
 
-	oldSlot, err := h.TraefikClient.GetNoWeightSlot(deploy.ServiceName)
-	if err != nil {
-		logger.WithError(err).Error("get current slot")
-		return fmt.Errorf("get current slot: %w", err)
-	}
+	// The service keeps pointing at the stable slot until the end of the finish, which
+	// makes it safe to run again after an interruption.
+	oldSlot := service.Version
 	logger.Info(fmt.Sprintf("[BlueGreen] Current slot is %s", oldSlot))
 
 	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
-	if err := h.TraefikClient.InsertWeightedService(deploy.ServiceName, []traefik.WeightedBackend{
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
 		{Name: slotName, Weight: 100},
 	}); err != nil {
 		return fmt.Errorf("cleanup weighted: %w", err)
 	}
 
-	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, oldSlot); err != nil {
-		logger.Warn(fmt.Sprintf("[BlueGreen] Failed to remove old slot: %v", err))
+	if oldSlot != deploy.Version {
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, oldSlot); err != nil {
+			logger.Warn(fmt.Sprintf("[BlueGreen] Failed to remove old slot: %v", err))
+		} else {
+			h.progress.SlotRemoved(ctx, deploy, oldSlot)
+		}
 	}
 
-	if err := h.TraefikClient.PointRouterTo(deploy.ServiceName, deploy.Version); err != nil {
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, deploy.Version); err != nil {
 		logger.Warn(fmt.Sprintf("[BlueGreen] Failed to point router: %v", err))
 		return fmt.Errorf("point router failed: %w", err)
 	}
 
-	service.Version = deploy.Version
-	service.Image = deploy.Image
+	release.Apply(service, deploy)
 
 	if err := h.db.UpdateService(ctx, *service); err != nil {
 		logger.WithError(err).Error("error on update service")
@@ -190,33 +322,85 @@ func (h *Handler) executeFinishBlueGreen(ctx context.Context, deploy *dto.Deploy
 }
 
 func (h *Handler) executeRollback(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("error get service: %w", err)
+	}
+
+	stableSlot := service.Version
+	if stableSlot == deploy.Version {
+		return fmt.Errorf("version %s is already the stable slot of %s", deploy.Version, deploy.ServiceName)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepRollBacking); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: deploy.ServiceName + "-" + stableSlot, Weight: 100},
+	}); err != nil {
+		return fmt.Errorf("restore weighted: %w", err)
+	}
+
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, stableSlot); err != nil {
+		logger.Warn(fmt.Sprintf("[BlueGreen] Failed to point router: %v", err))
+		return fmt.Errorf("point router failed: %w", err)
+	}
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+		logger.Warn(fmt.Sprintf("[BlueGreen] Failed to remove candidate slot: %v", err))
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, deploy.Version)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepRollback); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[BlueGreen] Rollback finished for %s, %s is serving all traffic", deploy.ServiceName, stableSlot))
 	return nil
 }
 
-func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
-	deploy.Step = step
-	if err := h.db.UpdateDeploymentStep(ctx, deploy.ID, step); err != nil {
-		return fmt.Errorf("update deployment: %w", err)
+// autoRollback gives all of the traffic back to the current slot when the candidate
+// misbehaves while traffic is being shifted to it.
+func (h *Handler) autoRollback(ctx context.Context, deploy *dto.Deployment, oldSlot string, cause error) error {
+	logger.WithError(cause).Error(fmt.Sprintf("[BlueGreen] Candidate %s-%s breached its thresholds, rolling back to %s", deploy.ServiceName, deploy.Version, oldSlot))
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepRollBacking); err != nil {
+		logger.WithError(err).Error("update deployment step")
 	}
-	return nil
+
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: deploy.ServiceName + "-" + oldSlot, Weight: 100},
+	}); err != nil {
+		return fmt.Errorf("restore weighted: %w", err)
+	}
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+		logger.Warn(fmt.Sprintf("[BlueGreen] Failed to remove candidate slot: %v", err))
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, deploy.Version)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFailed); err != nil {
+		logger.WithError(err).Error("update deployment step")
+	}
+
+	return fmt.Errorf("candidate rolled back: %w", cause)
 }
 
-func parseEnvString(envs string) []string {
-	var out []string
-	_ = json.Unmarshal([]byte(envs), &out)
-	return out
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
 }
 
-func extractPort(envs []string) int {
-	for _, env := range envs {
-		if strings.HasPrefix(env, "APP_PORT=") {
-			parts := strings.SplitN(env, "=", 2)
-			if len(parts) == 2 {
-				if portVal, err := strconv.Atoi(parts[1]); err == nil {
-					return portVal
-				}
-			}
-		}
+func (h *Handler) setWeights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) error {
+	if err := h.TraefikClient.InsertWeightedService(deploy.Application, deploy.ServiceName, backends); err != nil {
+		return err
 	}
-	return domain.DefaultServicePort
+
+	h.progress.Weights(ctx, deploy, backends)
+	return nil
 }
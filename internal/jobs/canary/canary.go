@@ -0,0 +1,315 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/convert"
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/guard"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/release"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/elissonalvesilva/releasy/pkg/utils"
+)
+
+type Handler struct {
+	DockerClient  docker.DockerClient
+	TraefikClient traefik.TraefikInterface
+	HealthChecker healthcheck.HealthChecker
+	Guard         *guard.Guard
+	db            store.DbStore
+	progress      *progress.Reporter
+}
+
+func New(
+	dockerClient docker.DockerClient,
+	traefikClient traefik.TraefikInterface,
+	healthChecker healthcheck.HealthChecker,
+	guard *guard.Guard,
+	db store.DbStore,
+	reporter *progress.Reporter,
+) *Handler {
+	return &Handler{
+		DockerClient:  dockerClient,
+		TraefikClient: traefikClient,
+		HealthChecker: healthChecker,
+		Guard:         guard,
+		db:            db,
+		progress:      reporter,
+	}
+}
+
+func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Action {
+	case domain.ActionDeployCreate:
+		return h.executeCanary(ctx, deploy)
+	default:
+		return fmt.Errorf("invalid action: %s", deploy.Action)
+	}
+}
+
+// Resume picks up a canary interrupted at the step it had recorded. A canary that
+// was already receiving traffic carries on from the weight it had reached.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Step {
+	case domain.StepCreating, domain.StepCreatingInfra:
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+			return fmt.Errorf("remove partial slot: %w", err)
+		}
+		return h.Run(ctx, deploy)
+	case domain.StepSwapTraffic, domain.StepPaused, domain.StepAwaitingPromotion:
+		return h.resumeSwap(ctx, deploy)
+	default:
+		return fmt.Errorf("cannot resume deployment %s from step %s", deploy.ID, deploy.Step)
+	}
+}
+
+// resumeSwap takes the canary steps again from the one at the weight the candidate had
+// reached, baking it anew, when the candidate is still healthy, and rolls back to the
+// stable slot otherwise.
+func (h *Handler) resumeSwap(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	// The service only moves to the candidate once the old slot is gone.
+	if service.Version == deploy.Version {
+		return h.updateDeploymentStep(ctx, deploy, domain.StepFinished)
+	}
+	oldSlot := service.Version
+
+	weights, err := h.TraefikClient.GetWeights(deploy.Application, deploy.ServiceName)
+	if err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("read weights: %w", err))
+	}
+
+	names, err := h.DockerClient.ListBySlot(deploy.ServiceName, deploy.Version)
+	if err != nil || len(names) == 0 {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("candidate slot is gone: %w", domain.ErrDeploymentInterrupted))
+	}
+
+	port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
+	if err := h.HealthChecker.CheckSlot(ctx, deploy.ServiceName, deploy.Version, port, deploy.HealthCheck); err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("candidate unhealthy after restart: %w", err))
+	}
+
+	weight := weights[deploy.Version]
+	steps := deploy.CanarySteps
+	for len(steps) > 1 && steps[0].Weight < weight {
+		steps = steps[1:]
+	}
+
+	logger.Info(fmt.Sprintf("[Canary] Resuming %s at candidate weight %d", deploy.ID, weight))
+	return h.shiftTraffic(ctx, deploy, service, steps, len(names), port)
+}
+
+func (h *Handler) executeCanary(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	if service.Version == deploy.Version {
+		return fmt.Errorf("version %s is already running for %s", deploy.Version, deploy.ServiceName)
+	}
+
+	if len(deploy.CanarySteps) == 0 {
+		return fmt.Errorf("no canary steps for deployment %s", deploy.ID)
+	}
+
+	oldSlot := service.Version
+	envs := utils.ParseEnvString(deploy.Envs)
+	port := utils.ExtractPort(envs)
+	canaryReplicas := utils.GetIntOrDefault(deploy.CanaryReplicas, domain.DefaultCanaryReplicas)
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepCreatingInfra); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	pulled, err := h.DockerClient.EnsureImage(deploy.Image)
+	if err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("ensure image: %w", err))
+	}
+	h.progress.ImageReady(ctx, deploy, pulled)
+
+	names, err := h.DockerClient.CreateService(
+		deploy.ServiceName,
+		deploy.Version,
+		deploy.Image,
+		uint64(canaryReplicas),
+		envs,
+		port,
+		convert.ToDockerHealthCheck(deploy.DockerHealthCheck),
+	)
+	if err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("create slot: %w", err))
+	}
+	h.progress.ContainersStarted(ctx, deploy, names...)
+
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("ensure router: %w", err))
+	}
+
+	if err := h.pingSlot(ctx, deploy, port); err != nil {
+		return h.abort(ctx, deploy, oldSlot, fmt.Errorf("healthcheck failed: %w", err))
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepSwapTraffic); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	return h.shiftTraffic(ctx, deploy, service, deploy.CanarySteps, canaryReplicas, port)
+}
+
+// shiftTraffic takes the canary steps, promoting the running replicas of the candidate
+// to the full replica count before the last one, and then retires the stable slot.
+func (h *Handler) shiftTraffic(ctx context.Context, deploy *dto.Deployment, service *dto.Service, steps []dto.CanaryStep, running, port int) error {
+	oldSlot := service.Version
+	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
+
+	watch := h.Guard.Watch(deploy.ServiceName, deploy.Version, port, deploy.HealthCheck, deploy.MaxErrorRate, utils.GetIntOrDefault(deploy.FailureThreshold, domain.DefaultFailureThreshold))
+	checkInterval := time.Duration(utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)) * time.Second
+
+	for _, step := range steps {
+		backends := []traefik.WeightedBackend{
+			{Name: deploy.ServiceName + "-" + oldSlot, Weight: 100 - step.Weight},
+			{Name: slotName, Weight: step.Weight},
+		}
+
+		if step.Weight == 100 {
+			if err := h.promote(ctx, deploy, running, port); err != nil {
+				return h.abort(ctx, deploy, oldSlot, err)
+			}
+			backends = backends[1:]
+		}
+
+		if err := h.setWeights(ctx, deploy, backends); err != nil {
+			return h.abort(ctx, deploy, oldSlot, fmt.Errorf("insert weighted: %w", err))
+		}
+
+		logger.Info(fmt.Sprintf("[Canary] Candidate weight is %d and Current is %d, baking for %ds", step.Weight, 100-step.Weight, step.Bake))
+		if err := watch.Observe(ctx, time.Duration(step.Bake)*time.Second, checkInterval); err != nil {
+			return h.abort(ctx, deploy, oldSlot, err)
+		}
+
+		if err := h.progress.Hold(ctx, deploy); err != nil {
+			return h.abort(ctx, deploy, oldSlot, err)
+		}
+	}
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, oldSlot); err != nil {
+		logger.Warn(fmt.Sprintf("[Canary] Failed to remove old slot: %v", err))
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, oldSlot)
+	}
+
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, deploy.Version); err != nil {
+		logger.Warn(fmt.Sprintf("[Canary] Failed to point router: %v", err))
+		return fmt.Errorf("point router failed: %w", err)
+	}
+
+	release.Apply(service, deploy)
+
+	if err := h.db.UpdateService(ctx, *service); err != nil {
+		logger.WithError(err).Error("error on update service")
+		return fmt.Errorf("error update service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinished); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[Canary] Rollout finished for %s", deploy.ServiceName))
+	return nil
+}
+
+// promote scales the candidate slot from its running replicas up to the full replica
+// count before it receives all of the traffic.
+func (h *Handler) promote(ctx context.Context, deploy *dto.Deployment, running, port int) error {
+	envs := utils.ParseEnvString(deploy.Envs)
+
+	logger.Info(fmt.Sprintf("[Canary] Promoting %s-%s to %d replicas", deploy.ServiceName, deploy.Version, deploy.Replicas))
+	for i := running + 1; i <= deploy.Replicas; i++ {
+		instanceName, err := h.DockerClient.CreateReplica(deploy.ServiceName, deploy.Version, deploy.Image, i, envs, port, convert.ToDockerHealthCheck(deploy.DockerHealthCheck))
+		if err != nil {
+			return fmt.Errorf("create replica: %w", err)
+		}
+		h.progress.ContainersStarted(ctx, deploy, instanceName)
+
+		if err := h.ping(ctx, deploy, instanceName, port); err != nil {
+			return fmt.Errorf("healthcheck failed for %s: %w", instanceName, err)
+		}
+	}
+
+	return nil
+}
+
+// ping waits for a new replica to pass its health check, probed on the address of the
+// container rather than the alias of the slot.
+func (h *Handler) ping(ctx context.Context, deploy *dto.Deployment, host string, port int) error {
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
+	defer cancel()
+
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	return h.HealthChecker.Ping(ctxPing, host, port, interval, deploy.HealthCheck)
+}
+
+// pingSlot waits for every container of the candidate slot, or the quorum of its health check.
+func (h *Handler) pingSlot(ctx context.Context, deploy *dto.Deployment, port int) error {
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
+	defer cancel()
+
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	return h.HealthChecker.PingSlot(ctxPing, deploy.ServiceName, deploy.Version, port, interval, deploy.HealthCheck)
+}
+
+// abort gives all of the traffic back to the stable slot and removes the candidate.
+func (h *Handler) abort(ctx context.Context, deploy *dto.Deployment, oldSlot string, cause error) error {
+	logger.WithError(cause).Error(fmt.Sprintf("[Canary] Rollout of %s failed, restoring %s", deploy.ServiceName, oldSlot))
+
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: deploy.ServiceName + "-" + oldSlot, Weight: 100},
+	}); err != nil {
+		logger.WithError(err).Error("[Canary] Failed to restore weights")
+	}
+
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+		logger.WithError(err).Error("[Canary] Failed to remove candidate slot")
+	} else {
+		h.progress.SlotRemoved(ctx, deploy, deploy.Version)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFailed); err != nil {
+		logger.WithError(err).Error("update deployment step")
+	}
+
+	return cause
+}
+
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
+}
+
+func (h *Handler) setWeights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) error {
+	if err := h.TraefikClient.InsertWeightedService(deploy.Application, deploy.ServiceName, backends); err != nil {
+		return err
+	}
+
+	h.progress.Weights(ctx, deploy, backends)
+	return nil
+}
@@ -0,0 +1,217 @@
+package canary
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/jobs/guard"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+)
+
+type testEnv struct {
+	db      *fakes.Store
+	docker  *fakes.Docker
+	traefik *fakes.Traefik
+	health  *fakes.HealthChecker
+}
+
+// newTestEnv runs v1 of shop/api on two replicas, receiving all of the traffic.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	env := &testEnv{
+		db:      fakes.NewStore(),
+		docker:  fakes.NewDocker(),
+		traefik: fakes.NewTraefik(),
+		health:  fakes.NewHealthChecker(),
+	}
+	env.db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v1", Image: "api:v1", Replicas: 2})
+	env.docker.AddSlot("api", "v1", 2)
+	if err := env.traefik.EnsureRouter("shop", "api", traefik.ServiceRoutes{}); err != nil {
+		t.Fatal(err)
+	}
+	env.setWeights(t, 100, 0)
+	return env
+}
+
+// setWeights splits the traffic between v1 and the v2 candidate.
+func (env *testEnv) setWeights(t *testing.T, v1, v2 int) {
+	t.Helper()
+
+	backends := []traefik.WeightedBackend{{Name: "api-v1", Weight: v1}}
+	if v2 > 0 {
+		backends = append(backends, traefik.WeightedBackend{Name: "api-v2", Weight: v2})
+	}
+	if err := env.traefik.InsertWeightedService("shop", "api", backends); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHandlerResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        string
+		setup       func(t *testing.T, env *testEnv)
+		wantErr     bool
+		wantStep    string
+		wantVersion string
+		wantWeights map[string]int
+		wantSlots   map[string]int
+		wantShifts  int
+	}{
+		{
+			name: "creating starts over",
+			step: domain.StepCreatingInfra,
+			setup: func(t *testing.T, env *testEnv) {
+				env.docker.AddSlot("api", "v2", 1)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v2": 100},
+			wantSlots:   map[string]int{"v1": 0, "v2": 2},
+			wantShifts:  3,
+		},
+		{
+			name: "swap goes on from the weight reached",
+			step: domain.StepSwapTraffic,
+			setup: func(t *testing.T, env *testEnv) {
+				env.docker.AddSlot("api", "v2", 1)
+				env.setWeights(t, 50, 50)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v2": 100},
+			wantSlots:   map[string]int{"v1": 0, "v2": 2},
+			wantShifts:  2,
+		},
+		{
+			name: "paused swap goes on",
+			step: domain.StepPaused,
+			setup: func(t *testing.T, env *testEnv) {
+				env.docker.AddSlot("api", "v2", 1)
+				env.setWeights(t, 90, 10)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v2": 100},
+			wantSlots:   map[string]int{"v1": 0, "v2": 2},
+			wantShifts:  3,
+		},
+		{
+			name: "swap with the candidate gone",
+			step: domain.StepSwapTraffic,
+			setup: func(t *testing.T, env *testEnv) {
+				env.setWeights(t, 50, 50)
+			},
+			wantErr:     true,
+			wantStep:    domain.StepFailed,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 0},
+		},
+		{
+			name: "swap with an unhealthy candidate",
+			step: domain.StepAwaitingPromotion,
+			setup: func(t *testing.T, env *testEnv) {
+				env.docker.AddSlot("api", "v2", 1)
+				env.setWeights(t, 50, 50)
+				env.health.SetUnhealthy("api-v2", true)
+			},
+			wantErr:     true,
+			wantStep:    domain.StepFailed,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 0},
+		},
+		{
+			name: "swap already recorded on the service",
+			step: domain.StepSwapTraffic,
+			setup: func(t *testing.T, env *testEnv) {
+				env.db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v2", Image: "api:v2", Replicas: 2})
+				env.docker.AddSlot("api", "v2", 2)
+				env.setWeights(t, 0, 100)
+			},
+			wantStep:    domain.StepFinished,
+			wantVersion: "v2",
+			wantWeights: map[string]int{"v1": 0, "v2": 100},
+			wantSlots:   map[string]int{"v1": 2, "v2": 2},
+		},
+		{
+			name:        "unknown step",
+			step:        domain.StepEffective,
+			wantErr:     true,
+			wantStep:    domain.StepEffective,
+			wantVersion: "v1",
+			wantWeights: map[string]int{"v1": 100},
+			wantSlots:   map[string]int{"v1": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			deploy := &dto.Deployment{
+				ID:                 "d1",
+				Application:        "shop",
+				ServiceName:        "api",
+				DeploymentStrategy: domain.StrategyCanary,
+				Version:            "v2",
+				Image:              "api:v2",
+				Replicas:           2,
+				Action:             domain.ActionDeployCreate,
+				Step:               tt.step,
+				FailureThreshold:   1,
+				CanaryReplicas:     1,
+				CanarySteps:        []dto.CanaryStep{{Weight: 10}, {Weight: 50}, {Weight: 100}},
+			}
+			if err := env.db.SaveDeployment(context.Background(), *deploy); err != nil {
+				t.Fatal(err)
+			}
+
+			h := New(env.docker, env.traefik, env.health, guard.New(env.health, nil), env.db, progress.New(env.db, fakes.NewStreams()))
+			err := h.Resume(context.Background(), deploy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := env.db.Step("d1"); got != tt.wantStep {
+				t.Errorf("step = %q, want %q", got, tt.wantStep)
+			}
+			service, err := env.db.GetService(context.Background(), "shop", "api")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if service.Version != tt.wantVersion {
+				t.Errorf("service version = %q, want %q", service.Version, tt.wantVersion)
+			}
+			if weights, _ := env.traefik.GetWeights("shop", "api"); !maps.Equal(weights, tt.wantWeights) {
+				t.Errorf("weights = %v, want %v", weights, tt.wantWeights)
+			}
+			for slot, want := range tt.wantSlots {
+				if got := len(env.docker.Slot("api", slot)); got != want {
+					t.Errorf("slot %s runs %d containers, want %d", slot, got, want)
+				}
+			}
+			if tt.wantShifts > 0 {
+				shifts := 0
+				for _, e := range env.db.Events {
+					if e.Type == domain.EventWeightChanged {
+						shifts++
+					}
+				}
+				if shifts != tt.wantShifts {
+					t.Errorf("traffic shifted %d times, want %d", shifts, tt.wantShifts)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package configure
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+)
+
+// Handler applies a change of the service definition that needs no new containers,
+// such as its routes, TLS options and certificate.
+type Handler struct {
+	TraefikClient traefik.TraefikInterface
+	db            store.DbStore
+	progress      *progress.Reporter
+}
+
+func New(
+	traefikClient traefik.TraefikInterface,
+	db store.DbStore,
+	reporter *progress.Reporter,
+) *Handler {
+	return &Handler{
+		TraefikClient: traefikClient,
+		db:            db,
+		progress:      reporter,
+	}
+}
+
+func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Action {
+	case domain.ActionRoutesUpdate:
+		return h.executeRoutesUpdate(ctx, deploy)
+	default:
+		return fmt.Errorf("invalid action: %s", deploy.Action)
+	}
+}
+
+// Resume applies the change again, as it only writes the current definition.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	return h.Run(ctx, deploy)
+}
+
+func (h *Handler) executeRoutesUpdate(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepConfiguring); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	if service.Certificate != nil {
+		err = h.TraefikClient.SetCertificate(deploy.Application, deploy.ServiceName, service.Certificate.Cert, service.Certificate.Key)
+	} else {
+		err = h.TraefikClient.RemoveCertificate(deploy.Application, deploy.ServiceName)
+	}
+	if err != nil {
+		logger.WithError(err).Error("update traefik certificate")
+		return fmt.Errorf("update certificate: %w", err)
+	}
+
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
+		logger.WithError(err).Error("update traefik routers")
+		return fmt.Errorf("ensure router: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinished); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[Configure] Routes of %s/%s updated", deploy.Application, deploy.ServiceName))
+	return nil
+}
+
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
+}
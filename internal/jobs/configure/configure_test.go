@@ -0,0 +1,88 @@
+package configure
+
+import (
+	"context"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+)
+
+func TestHandlerResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        string
+		service     *dto.Service
+		certificate string
+		wantErr     bool
+		wantStep    string
+		wantCert    string
+	}{
+		{
+			name:     "creating applies the routes",
+			step:     domain.StepCreating,
+			service:  &dto.Service{Application: "shop", Name: "api", Version: "v1", Certificate: &dto.Certificate{Cert: "cert", Key: "key"}},
+			wantStep: domain.StepFinished,
+			wantCert: "cert",
+		},
+		{
+			name:        "configuring applies them again",
+			step:        domain.StepConfiguring,
+			service:     &dto.Service{Application: "shop", Name: "api", Version: "v1"},
+			certificate: "old",
+			wantStep:    domain.StepFinished,
+		},
+		{
+			name:     "service gone",
+			step:     domain.StepConfiguring,
+			wantErr:  true,
+			wantStep: domain.StepConfiguring,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			traefikClient := fakes.NewTraefik()
+			if tt.service != nil {
+				db.AddService(*tt.service)
+			}
+			if tt.certificate != "" {
+				if err := traefikClient.SetCertificate("shop", "api", tt.certificate, "key"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			deploy := &dto.Deployment{
+				ID:                 "d1",
+				Application:        "shop",
+				ServiceName:        "api",
+				DeploymentStrategy: domain.StrategyConfigure,
+				Version:            "v1",
+				Action:             domain.ActionRoutesUpdate,
+				Step:               tt.step,
+			}
+			if err := db.SaveDeployment(context.Background(), *deploy); err != nil {
+				t.Fatal(err)
+			}
+
+			h := New(traefikClient, db, progress.New(db, fakes.NewStreams()))
+			err := h.Resume(context.Background(), deploy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := db.Step("d1"); got != tt.wantStep {
+				t.Errorf("step = %q, want %q", got, tt.wantStep)
+			}
+			if got := traefikClient.Certificates["shop/api"]; got != tt.wantCert {
+				t.Errorf("certificate = %q, want %q", got, tt.wantCert)
+			}
+			if _, ok := traefikClient.Routes["shop/api"]; ok != !tt.wantErr {
+				t.Errorf("router written = %v, want %v", ok, !tt.wantErr)
+			}
+		})
+	}
+}
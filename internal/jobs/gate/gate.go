@@ -0,0 +1,113 @@
+package gate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+)
+
+// Gate holds a deployment between two traffic steps. A manual deployment waits for a
+// promotion at every step, and any deployment waits while it is paused.
+type Gate struct {
+	mu       sync.Mutex
+	manual   bool
+	paused   bool
+	promoted bool
+	changed  chan struct{}
+}
+
+type gateKey struct{}
+
+func New(manual bool) *Gate {
+	return &Gate{
+		manual:  manual,
+		changed: make(chan struct{}),
+	}
+}
+
+// WithGate returns a context whose traffic steps are held by g.
+func WithGate(ctx context.Context, g *Gate) context.Context {
+	return context.WithValue(ctx, gateKey{}, g)
+}
+
+// FromContext returns the gate of ctx, or nil when its steps are never held.
+func FromContext(ctx context.Context) *Gate {
+	g, _ := ctx.Value(gateKey{}).(*Gate)
+	return g
+}
+
+// Promote lets the deployment take its next step, whether it is held yet or not.
+func (g *Gate) Promote() {
+	g.update(func() { g.promoted = true })
+}
+
+// Pause holds the deployment at its next step until it is promoted or resumed.
+func (g *Gate) Pause() {
+	g.update(func() { g.paused = true })
+}
+
+// Resume lets the deployment take every following step without waiting.
+func (g *Gate) Resume() {
+	g.update(func() {
+		g.paused = false
+		g.manual = false
+	})
+}
+
+// Wait blocks until the deployment may take its next step or ctx is done. onHold is
+// called with the step the deployment waits in every time that step changes.
+func (g *Gate) Wait(ctx context.Context, onHold func(step string)) error {
+	if g == nil {
+		return nil
+	}
+
+	held := ""
+	for {
+		g.mu.Lock()
+		step := g.holdLocked()
+		changed := g.changed
+		g.mu.Unlock()
+
+		if step == "" {
+			return nil
+		}
+
+		if step != held {
+			onHold(step)
+			held = step
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// holdLocked returns the step to wait in, or consumes a promotion and returns "".
+func (g *Gate) holdLocked() string {
+	if g.promoted {
+		g.promoted = false
+		return ""
+	}
+
+	switch {
+	case g.paused:
+		return domain.StepPaused
+	case g.manual:
+		return domain.StepAwaitingPromotion
+	default:
+		return ""
+	}
+}
+
+func (g *Gate) update(fn func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	fn()
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
@@ -0,0 +1,110 @@
+package gate
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+)
+
+func TestGateWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		gate      *Gate
+		before    func(g *Gate)
+		onHold    func(g *Gate, step string)
+		wantHolds []string
+		wantErr   error
+	}{
+		{
+			name: "no gate",
+		},
+		{
+			name: "automatic",
+			gate: New(false),
+		},
+		{
+			name: "manual until promoted",
+			gate: New(true),
+			onHold: func(g *Gate, _ string) {
+				g.Promote()
+			},
+			wantHolds: []string{domain.StepAwaitingPromotion},
+		},
+		{
+			name: "promoted before it is held",
+			gate: New(true),
+			before: func(g *Gate) {
+				g.Promote()
+			},
+		},
+		{
+			name: "paused until resumed",
+			gate: New(true),
+			before: func(g *Gate) {
+				g.Pause()
+			},
+			onHold: func(g *Gate, _ string) {
+				g.Resume()
+			},
+			wantHolds: []string{domain.StepPaused},
+		},
+		{
+			name: "paused while awaiting promotion",
+			gate: New(true),
+			onHold: func(g *Gate, step string) {
+				if step == domain.StepAwaitingPromotion {
+					g.Pause()
+					return
+				}
+				g.Promote()
+			},
+			wantHolds: []string{domain.StepAwaitingPromotion, domain.StepPaused},
+		},
+		{
+			name:      "cancelled while held",
+			gate:      New(true),
+			wantHolds: []string{domain.StepAwaitingPromotion},
+			wantErr:   context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.before != nil {
+				tt.before(tt.gate)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			var holds []string
+			err := tt.gate.Wait(ctx, func(step string) {
+				holds = append(holds, step)
+				if tt.onHold != nil {
+					go tt.onHold(tt.gate, step)
+				}
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Wait() error = %v, want %v", err, tt.wantErr)
+			}
+			if !slices.Equal(holds, tt.wantHolds) {
+				t.Errorf("held in %v, want %v", holds, tt.wantHolds)
+			}
+		})
+	}
+}
+
+func TestGateFromContext(t *testing.T) {
+	if g := FromContext(context.Background()); g != nil {
+		t.Errorf("FromContext() = %v, want nil", g)
+	}
+
+	g := New(true)
+	if got := FromContext(WithGate(context.Background(), g)); got != g {
+		t.Errorf("FromContext() = %p, want %p", got, g)
+	}
+}
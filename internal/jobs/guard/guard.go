@@ -0,0 +1,154 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+)
+
+type (
+	// Guard watches a candidate slot while it receives traffic.
+	Guard struct {
+		HealthChecker healthcheck.HealthChecker
+		Metrics       traefik.MetricsReader
+	}
+
+	// Watch holds the state of one candidate across the weight steps of a deployment.
+	Watch struct {
+		guard            *Guard
+		serviceName      string
+		slot             string
+		slotName         string
+		port             int
+		spec             dto.HealthCheck
+		maxErrorRate     float64
+		failureThreshold int
+		failures         int
+		baseTotal        float64
+		baseFailed       float64
+	}
+)
+
+var (
+	ErrCandidateUnhealthy = errors.New("candidate failed its health checks")
+	ErrErrorRateExceeded  = errors.New("candidate error rate exceeded")
+)
+
+// minRequests is the amount of requests a step must serve before its error rate is trusted.
+const minRequests = 10
+
+// New creates a guard. metrics may be nil, in which case error rates are not watched.
+func New(healthChecker healthcheck.HealthChecker, metrics traefik.MetricsReader) *Guard {
+	return &Guard{
+		HealthChecker: healthChecker,
+		Metrics:       metrics,
+	}
+}
+
+// Watch starts watching the candidate slot of a service. A zero maxErrorRate disables
+// the error rate check.
+func (g *Guard) Watch(serviceName, slot string, port int, spec dto.HealthCheck, maxErrorRate float64, failureThreshold int) *Watch {
+	w := &Watch{
+		guard:            g,
+		serviceName:      serviceName,
+		slot:             slot,
+		slotName:         serviceName + "-" + slot,
+		port:             port,
+		spec:             spec,
+		maxErrorRate:     maxErrorRate,
+		failureThreshold: failureThreshold,
+	}
+	w.resetBaseline()
+	return w
+}
+
+// Observe health checks the candidate every checkInterval for the given duration and,
+// at the end, compares its error rate on that window with the allowed maximum.
+func (w *Watch) Observe(ctx context.Context, duration, checkInterval time.Duration) error {
+	if checkInterval <= 0 || checkInterval > duration {
+		checkInterval = max(duration, time.Second)
+	}
+
+	deadline := time.NewTimer(duration)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := w.check(ctx); err != nil {
+				return err
+			}
+		case <-deadline.C:
+			if err := w.check(ctx); err != nil {
+				return err
+			}
+			return w.checkErrorRate()
+		}
+	}
+}
+
+func (w *Watch) check(ctx context.Context) error {
+	if err := w.guard.HealthChecker.CheckSlot(ctx, w.serviceName, w.slot, w.port, w.spec); err != nil {
+		w.failures++
+		logger.WithError(err).Warn(fmt.Sprintf("[Guard] %s health check failed (%d/%d)", w.slotName, w.failures, w.failureThreshold))
+		if w.failures >= w.failureThreshold {
+			return fmt.Errorf("%w: %v", ErrCandidateUnhealthy, err)
+		}
+		return nil
+	}
+
+	w.failures = 0
+	return nil
+}
+
+func (w *Watch) checkErrorRate() error {
+	if w.guard.Metrics == nil || w.maxErrorRate == 0 {
+		return nil
+	}
+
+	total, failed, err := w.guard.Metrics.ServiceRequests(w.slotName)
+	if err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Guard] Failed to read metrics of %s", w.slotName))
+		return nil
+	}
+
+	stepTotal := total - w.baseTotal
+	stepFailed := failed - w.baseFailed
+	w.baseTotal, w.baseFailed = total, failed
+
+	if stepTotal < minRequests {
+		return nil
+	}
+
+	rate := stepFailed / stepTotal
+	logger.Info(fmt.Sprintf("[Guard] %s error rate is %.4f on %.0f requests", w.slotName, rate, stepTotal))
+	if rate > w.maxErrorRate {
+		return fmt.Errorf("%w: %.4f > %.4f", ErrErrorRateExceeded, rate, w.maxErrorRate)
+	}
+
+	return nil
+}
+
+func (w *Watch) resetBaseline() {
+	if w.guard.Metrics == nil || w.maxErrorRate == 0 {
+		return
+	}
+
+	total, failed, err := w.guard.Metrics.ServiceRequests(w.slotName)
+	if err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Guard] Failed to read metrics of %s", w.slotName))
+		return
+	}
+	w.baseTotal, w.baseFailed = total, failed
+}
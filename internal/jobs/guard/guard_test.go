@@ -0,0 +1,101 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+)
+
+// metrics reports the request counters of the candidate, before and once it is watched.
+type metrics struct {
+	total  float64
+	failed float64
+}
+
+func (m *metrics) ServiceRequests(string) (float64, float64, error) {
+	return m.total, m.failed, nil
+}
+
+func TestWatchObserve(t *testing.T) {
+	tests := []struct {
+		name             string
+		unhealthy        bool
+		failureThreshold int
+		observes         int
+		maxErrorRate     float64
+		before           metrics
+		after            metrics
+		wantErr          error
+	}{
+		{
+			name:             "healthy",
+			failureThreshold: 1,
+		},
+		{
+			name:             "unhealthy below the threshold",
+			unhealthy:        true,
+			failureThreshold: 2,
+		},
+		{
+			name:             "unhealthy reaching the threshold",
+			unhealthy:        true,
+			failureThreshold: 1,
+			wantErr:          ErrCandidateUnhealthy,
+		},
+		{
+			name:             "failures add up across steps",
+			unhealthy:        true,
+			failureThreshold: 2,
+			observes:         2,
+			wantErr:          ErrCandidateUnhealthy,
+		},
+		{
+			name:             "error rate exceeded on the window",
+			failureThreshold: 1,
+			maxErrorRate:     0.1,
+			before:           metrics{total: 100},
+			after:            metrics{total: 200, failed: 50},
+			wantErr:          ErrErrorRateExceeded,
+		},
+		{
+			name:             "error rate within the maximum",
+			failureThreshold: 1,
+			maxErrorRate:     0.1,
+			before:           metrics{total: 100, failed: 50},
+			after:            metrics{total: 200, failed: 55},
+		},
+		{
+			name:             "too few requests",
+			failureThreshold: 1,
+			maxErrorRate:     0.1,
+			after:            metrics{total: 5, failed: 5},
+		},
+		{
+			name:             "error rate not watched",
+			failureThreshold: 1,
+			after:            metrics{total: 100, failed: 100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			health := fakes.NewHealthChecker()
+			health.SetUnhealthy("api-v2", tt.unhealthy)
+			m := tt.before
+
+			w := New(health, &m).Watch("api", "v2", 8080, dto.HealthCheck{}, tt.maxErrorRate, tt.failureThreshold)
+			m = tt.after
+
+			var err error
+			for i := 0; i < max(tt.observes, 1) && err == nil; i++ {
+				err = w.Observe(context.Background(), 0, 0)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Observe() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
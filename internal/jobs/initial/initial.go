@@ -3,10 +3,13 @@ package initial
 import (
 	"context"
 	"fmt"
+	"github.com/elissonalvesilva/releasy/internal/convert"
 	"github.com/elissonalvesilva/releasy/internal/core/domain"
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
 	"github.com/elissonalvesilva/releasy/internal/docker"
 	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
 	"github.com/elissonalvesilva/releasy/internal/store"
 	"github.com/elissonalvesilva/releasy/internal/traefik"
 	"github.com/elissonalvesilva/releasy/pkg/logger"
@@ -19,6 +22,7 @@ type Handler struct {
 	TraefikClient traefik.TraefikInterface
 	HealthChecker healthcheck.HealthChecker
 	db            store.DbStore
+	progress      *progress.Reporter
 }
 
 func NewAgent(
@@ -26,17 +30,19 @@ func NewAgent(
 	traefikClient traefik.TraefikInterface,
 	healthChecker healthcheck.HealthChecker,
 	db store.DbStore,
+	reporter *progress.Reporter,
 ) *Handler {
 	return &Handler{
 		DockerClient:  dockerClient,
 		TraefikClient: traefikClient,
 		HealthChecker: healthChecker,
 		db:            db,
+		progress:      reporter,
 	}
 }
 
 func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
-	_, err := h.getService(ctx, deploy)
+	service, err := h.getService(ctx, deploy)
 	if err != nil {
 		logger.Error(ctx, "Failed to get service", "error", err)
 		return err
@@ -49,45 +55,52 @@ func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
 		return fmt.Errorf("update deployment step: %w", err)
 	}
 
-	if err := h.DockerClient.CreateService(
+	pulled, err := h.DockerClient.EnsureImage(deploy.Image)
+	if err != nil {
+		logger.WithError(err).Error("ensure image")
+		return fmt.Errorf("ensure image: %w", err)
+	}
+	h.progress.ImageReady(ctx, deploy, pulled)
+
+	names, err := h.DockerClient.CreateService(
 		deploy.ServiceName,
 		deploy.Version,
 		deploy.Image,
 		uint64(deploy.Replicas),
 		utils.ParseEnvString(deploy.Envs),
 		port,
-		true,
-	); err != nil {
+		convert.ToDockerHealthCheck(deploy.DockerHealthCheck),
+	)
+	if err != nil {
 		logger.WithError(err).Error("create service")
 		return fmt.Errorf("create slot: %w", err)
 	}
+	h.progress.ContainersStarted(ctx, deploy, names...)
 
-	if err := h.TraefikClient.EnsureRouter(
-		deploy.ServiceName,
-		fmt.Sprintf("Host(`%s.local`)", deploy.ServiceName),
-	); err != nil {
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
 		logger.WithError(err).Error("create traefik router")
 		return fmt.Errorf("ensure router: %w", err)
 	}
 
-	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(deploy.MaxWaitTime)*time.Second)
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
 	defer cancel()
 
-	slotName := fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version)
-	if err := h.HealthChecker.Ping(ctxPing, slotName, port, deploy.HealthCheckInterval); err != nil {
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	if err := h.HealthChecker.PingSlot(ctxPing, deploy.ServiceName, deploy.Version, port, interval, deploy.HealthCheck); err != nil {
 		_ = h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version)
 		logger.WithError(err).Error("check health check")
 		return fmt.Errorf("healthcheck failed: %w", err)
 	}
 
-	if err := h.TraefikClient.InsertWeightedService(deploy.ServiceName, []traefik.WeightedBackend{
-		{Name: slotName, Weight: 100},
+	if err := h.setWeights(ctx, deploy, []traefik.WeightedBackend{
+		{Name: fmt.Sprintf("%s-%s", deploy.ServiceName, deploy.Version), Weight: 100},
 	}); err != nil {
 		logger.WithError(err).Error("insert weighted service")
 		return fmt.Errorf("cleanup weighted: %w", err)
 	}
 
-	if err := h.TraefikClient.PointRouterTo(deploy.ServiceName, deploy.Version); err != nil {
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, deploy.Version); err != nil {
 		logger.Warn(fmt.Sprintf("[Inital] Failed to point router: %v", err))
 		return fmt.Errorf("point router failed: %w", err)
 	}
@@ -100,6 +113,14 @@ func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
 	return nil
 }
 
+// Resume starts an interrupted first deployment again, as the service was not serving yet.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+		return fmt.Errorf("remove partial slot: %w", err)
+	}
+	return h.Run(ctx, deploy)
+}
+
 func (h *Handler) getService(ctx context.Context, deploy *dto.Deployment) (*dto.Service, error) {
 	logger.Info(deploy)
 	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
@@ -111,9 +132,14 @@ func (h *Handler) getService(ctx context.Context, deploy *dto.Deployment) (*dto.
 }
 
 func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
-	deploy.Step = step
-	if err := h.db.UpdateDeploymentStep(ctx, deploy.ID, step); err != nil {
-		return fmt.Errorf("update deployment: %w", err)
+	return h.progress.Step(ctx, deploy, step)
+}
+
+func (h *Handler) setWeights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) error {
+	if err := h.TraefikClient.InsertWeightedService(deploy.Application, deploy.ServiceName, backends); err != nil {
+		return err
 	}
+
+	h.progress.Weights(ctx, deploy, backends)
 	return nil
 }
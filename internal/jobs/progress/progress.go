@@ -0,0 +1,213 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/gate"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/google/uuid"
+)
+
+// Reporter records the progress of a deployment and publishes it to whoever is following it.
+type Reporter struct {
+	db     store.DbStore
+	stream store.Streams
+}
+
+func New(db store.DbStore, stream store.Streams) *Reporter {
+	return &Reporter{
+		db:     db,
+		stream: stream,
+	}
+}
+
+// Cancelled reports whether ctx was cancelled because the deployment was cancelled.
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), domain.ErrDeploymentCancelled)
+}
+
+// Step moves the deployment to step. It is still recorded once ctx is cancelled, so
+// that handlers can clean up after a cancellation, and a deployment that fails because
+// it was cancelled is recorded as cancelled.
+func (r *Reporter) Step(ctx context.Context, deploy *dto.Deployment, step string) error {
+	if step == domain.StepFailed && Cancelled(ctx) {
+		step = domain.StepCancelled
+	}
+
+	deploy.Step = step
+	if err := r.db.UpdateDeploymentStep(context.WithoutCancel(ctx), deploy.ID, step); err != nil {
+		return fmt.Errorf("update deployment: %w", err)
+	}
+
+	r.publish(dto.DeploymentProgress{
+		DeploymentID: deploy.ID,
+		Type:         domain.ProgressStep,
+		Step:         step,
+		CreatedAt:    time.Now(),
+	})
+	return nil
+}
+
+// Hold waits, when the gate of ctx asks for it, before the deployment takes its next
+// traffic step. The step it waits in is recorded, and the step it was in is restored
+// once it goes on.
+func (r *Reporter) Hold(ctx context.Context, deploy *dto.Deployment) error {
+	previous := deploy.Step
+	held := false
+
+	err := gate.FromContext(ctx).Wait(ctx, func(step string) {
+		held = true
+		logger.Info(fmt.Sprintf("[Progress] Deployment %s is %s", deploy.ID, step))
+		if err := r.Step(ctx, deploy, step); err != nil {
+			logger.WithError(err).Warn(fmt.Sprintf("[Progress] Failed to record %s on %s", step, deploy.ID))
+		}
+	})
+	if err != nil || !held {
+		return err
+	}
+
+	return r.Step(ctx, deploy, previous)
+}
+
+// Weights publishes and records the traffic split applied to the service of the deployment.
+func (r *Reporter) Weights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) {
+	weights := make([]dto.Weight, 0, len(backends))
+	details := map[string]interface{}{}
+	for _, b := range backends {
+		weights = append(weights, dto.Weight{Slot: b.Name, Weight: b.Weight})
+		details[b.Name] = b.Weight
+	}
+
+	r.publish(dto.DeploymentProgress{
+		DeploymentID: deploy.ID,
+		Type:         domain.ProgressWeights,
+		Step:         deploy.Step,
+		Weights:      weights,
+		CreatedAt:    time.Now(),
+	})
+
+	r.record(ctx, deploy, domain.EventWeightChanged, fmt.Sprintf("traffic split set to %v", details), details)
+}
+
+// ImageReady records whether the image of the deployment had to be pulled.
+func (r *Reporter) ImageReady(ctx context.Context, deploy *dto.Deployment, pulled bool) {
+	details := map[string]interface{}{"image": deploy.Image}
+	if pulled {
+		r.Event(ctx, deploy, domain.EventImagePulled, fmt.Sprintf("image %s pulled", deploy.Image), details)
+		return
+	}
+	r.Event(ctx, deploy, domain.EventImagePresent, fmt.Sprintf("image %s already present", deploy.Image), details)
+}
+
+// ContainersStarted records every container started for the deployment.
+func (r *Reporter) ContainersStarted(ctx context.Context, deploy *dto.Deployment, names ...string) {
+	for _, name := range names {
+		r.Event(ctx, deploy, domain.EventContainerStarted, fmt.Sprintf("container %s started", name), map[string]interface{}{
+			"container": name,
+			"image":     deploy.Image,
+		})
+	}
+}
+
+// SlotRemoved records the removal of every container of a slot.
+func (r *Reporter) SlotRemoved(ctx context.Context, deploy *dto.Deployment, slot string) {
+	r.Event(ctx, deploy, domain.EventSlotRemoved, fmt.Sprintf("slot %s-%s removed", deploy.ServiceName, slot), map[string]interface{}{
+		"slot": slot,
+	})
+}
+
+// Failed records the error that stopped the deployment.
+func (r *Reporter) Failed(ctx context.Context, deploy *dto.Deployment, cause error) {
+	r.Event(ctx, deploy, domain.EventError, cause.Error(), map[string]interface{}{
+		"step":   deploy.Step,
+		"action": deploy.Action,
+	})
+}
+
+// HealthCheckObserver returns an observer recording the health check attempts made for the deployment.
+func (r *Reporter) HealthCheckObserver(ctx context.Context, deploy *dto.Deployment) healthcheck.Observer {
+	return func(host string, attempt int, err error) {
+		details := map[string]interface{}{
+			"host":    host,
+			"attempt": attempt,
+			"healthy": err == nil,
+		}
+
+		message := fmt.Sprintf("health check of %s succeeded", host)
+		if err != nil {
+			details["error"] = err.Error()
+			message = fmt.Sprintf("health check of %s failed: %v", host, err)
+		}
+
+		r.Event(ctx, deploy, domain.EventHealthCheck, message, details)
+	}
+}
+
+// Event publishes and records a structured event on the timeline of the deployment.
+func (r *Reporter) Event(ctx context.Context, deploy *dto.Deployment, eventType, message string, details map[string]interface{}) {
+	event := r.record(ctx, deploy, eventType, message, details)
+
+	r.publish(dto.DeploymentProgress{
+		DeploymentID: deploy.ID,
+		Type:         domain.ProgressEvent,
+		Step:         deploy.Step,
+		Event:        event,
+		CreatedAt:    event.CreatedAt,
+	})
+}
+
+// record is best effort: a deployment must not fail because its timeline could not be written.
+func (r *Reporter) record(ctx context.Context, deploy *dto.Deployment, eventType, message string, details map[string]interface{}) *dto.Event {
+	event := &dto.Event{
+		ID:           uuid.NewString(),
+		Application:  deploy.Application,
+		ServiceName:  deploy.ServiceName,
+		DeploymentID: deploy.ID,
+		Type:         eventType,
+		Message:      message,
+		Details:      details,
+		CreatedAt:    time.Now(),
+	}
+
+	rawDetails, err := json.Marshal(details)
+	if err != nil {
+		rawDetails = []byte("{}")
+	}
+
+	if err := r.db.SaveEvent(context.WithoutCancel(ctx), store.Event{
+		ID:           event.ID,
+		Application:  event.Application,
+		ServiceName:  event.ServiceName,
+		DeploymentID: event.DeploymentID,
+		Type:         event.Type,
+		Message:      event.Message,
+		Details:      string(rawDetails),
+		CreatedAt:    event.CreatedAt,
+	}); err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Progress] Failed to save %s event of %s", eventType, deploy.ID))
+	}
+
+	return event
+}
+
+// publish is best effort: nobody may be following the deployment.
+func (r *Reporter) publish(event dto.DeploymentProgress) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.WithError(err).Warn("[Progress] Failed to encode event")
+		return
+	}
+
+	if err := r.stream.Publish(store.DeploymentChannel(event.DeploymentID), string(payload)); err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Progress] Failed to publish %s event of %s", event.Type, event.DeploymentID))
+	}
+}
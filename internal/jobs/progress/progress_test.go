@@ -0,0 +1,114 @@
+package progress
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/jobs/gate"
+)
+
+func newTestDeployment(t *testing.T, db *fakes.Store) *dto.Deployment {
+	t.Helper()
+
+	deploy := &dto.Deployment{ID: "d1", Application: "shop", ServiceName: "api", Version: "v2", Step: domain.StepSwapTraffic}
+	if err := db.SaveDeployment(context.Background(), *deploy); err != nil {
+		t.Fatal(err)
+	}
+	return deploy
+}
+
+func TestReporterStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		step     string
+		cause    error
+		wantStep string
+	}{
+		{name: "recorded", step: domain.StepFinished, wantStep: domain.StepFinished},
+		{name: "failure", step: domain.StepFailed, wantStep: domain.StepFailed},
+		{name: "failure after a cancellation", step: domain.StepFailed, cause: domain.ErrDeploymentCancelled, wantStep: domain.StepCancelled},
+		{name: "failure after a shutdown", step: domain.StepFailed, cause: domain.ErrDeploymentInterrupted, wantStep: domain.StepFailed},
+		{name: "cleanup after a cancellation", step: domain.StepRollBacking, cause: domain.ErrDeploymentCancelled, wantStep: domain.StepRollBacking},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			deploy := newTestDeployment(t, db)
+
+			ctx, cancel := context.WithCancelCause(context.Background())
+			if tt.cause != nil {
+				cancel(tt.cause)
+			}
+			defer cancel(nil)
+
+			if err := New(db, fakes.NewStreams()).Step(ctx, deploy, tt.step); err != nil {
+				t.Fatal(err)
+			}
+			if deploy.Step != tt.wantStep || db.Step("d1") != tt.wantStep {
+				t.Errorf("step = %q, recorded %q, want %q", deploy.Step, db.Step("d1"), tt.wantStep)
+			}
+		})
+	}
+}
+
+func TestReporterHold(t *testing.T) {
+	tests := []struct {
+		name      string
+		gate      *gate.Gate
+		promote   bool
+		wantErr   error
+		wantSteps []string
+	}{
+		{
+			name:      "not held",
+			gate:      gate.New(false),
+			wantSteps: []string{domain.StepSwapTraffic},
+		},
+		{
+			name:      "held until promoted",
+			gate:      gate.New(true),
+			promote:   true,
+			wantSteps: []string{domain.StepSwapTraffic, domain.StepAwaitingPromotion, domain.StepSwapTraffic},
+		},
+		{
+			name:      "cancelled while held",
+			gate:      gate.New(true),
+			wantErr:   context.DeadlineExceeded,
+			wantSteps: []string{domain.StepSwapTraffic, domain.StepAwaitingPromotion},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			deploy := newTestDeployment(t, db)
+
+			ctx, cancel := context.WithTimeout(gate.WithGate(context.Background(), tt.gate), 100*time.Millisecond)
+			defer cancel()
+
+			if tt.promote {
+				go func() {
+					for db.Step("d1") != domain.StepAwaitingPromotion {
+						time.Sleep(time.Millisecond)
+					}
+					tt.gate.Promote()
+				}()
+			}
+
+			err := New(db, fakes.NewStreams()).Hold(ctx, deploy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Hold() error = %v, want %v", err, tt.wantErr)
+			}
+			if got := db.Steps["d1"]; !slices.Equal(got, tt.wantSteps) {
+				t.Errorf("steps = %v, want %v", got, tt.wantSteps)
+			}
+		})
+	}
+}
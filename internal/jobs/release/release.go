@@ -0,0 +1,17 @@
+// Package release records on a service what a finished deployment left running.
+package release
+
+import "github.com/elissonalvesilva/releasy/internal/core/dto"
+
+// Apply sets the version and image of deploy on service, and the spec a redeploy of
+// the service was started for.
+func Apply(service *dto.Service, deploy *dto.Deployment) {
+	service.Version = deploy.Version
+	service.Image = deploy.Image
+
+	if spec := deploy.Pending; spec != nil {
+		service.Replicas = spec.Replicas
+		service.Envs = spec.Envs
+		service.DockerHealthCheck = spec.DockerHealthCheck
+	}
+}
@@ -0,0 +1,385 @@
+package rolling
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elissonalvesilva/releasy/internal/convert"
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/internal/healthcheck"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/jobs/release"
+	"github.com/elissonalvesilva/releasy/internal/jobs/routing"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+	"github.com/elissonalvesilva/releasy/pkg/utils"
+)
+
+type Handler struct {
+	DockerClient  docker.DockerClient
+	TraefikClient traefik.TraefikInterface
+	HealthChecker healthcheck.HealthChecker
+	db            store.DbStore
+	progress      *progress.Reporter
+}
+
+// rollout keeps track of the replicas of both slots while they are replaced batch by batch.
+type rollout struct {
+	service    *dto.Service
+	deploy     *dto.Deployment
+	oldSlot    string
+	oldNames   []string
+	removedOld []string
+	newCount   int
+}
+
+func New(
+	dockerClient docker.DockerClient,
+	traefikClient traefik.TraefikInterface,
+	healthChecker healthcheck.HealthChecker,
+	db store.DbStore,
+	reporter *progress.Reporter,
+) *Handler {
+	return &Handler{
+		DockerClient:  dockerClient,
+		TraefikClient: traefikClient,
+		HealthChecker: healthChecker,
+		db:            db,
+		progress:      reporter,
+	}
+}
+
+func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Action {
+	case domain.ActionDeployCreate:
+		return h.executeRollingUpdate(ctx, deploy)
+	default:
+		return fmt.Errorf("invalid action: %s", deploy.Action)
+	}
+}
+
+// Resume picks up a rolling update interrupted at the step it had recorded. Once
+// replicas were replaced, the rollout carries on from the healthy replicas of the
+// candidate, or brings the old slot back to its full size when one of them is not.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Step {
+	case domain.StepCreating, domain.StepCreatingInfra:
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, deploy.Version); err != nil {
+			return fmt.Errorf("remove partial slot: %w", err)
+		}
+		return h.Run(ctx, deploy)
+	case domain.StepSwapTraffic:
+		service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+		if err != nil {
+			return fmt.Errorf("get service: %w", err)
+		}
+
+		if service.Version == deploy.Version {
+			return h.updateDeploymentStep(ctx, deploy, domain.StepFinished)
+		}
+
+		return h.resumeSwap(ctx, deploy, service)
+	default:
+		return fmt.Errorf("cannot resume deployment %s from step %s", deploy.ID, deploy.Step)
+	}
+}
+
+// resumeSwap rebuilds the rollout from the replicas left in both slots. Every replica
+// of the candidate is probed once; the rollout goes on from them when they all pass, and
+// is aborted otherwise.
+func (h *Handler) resumeSwap(ctx context.Context, deploy *dto.Deployment, service *dto.Service) error {
+	oldNames, err := h.DockerClient.ListBySlot(deploy.ServiceName, service.Version)
+	if err != nil {
+		return fmt.Errorf("list current slot: %w", err)
+	}
+
+	r := &rollout{
+		service:  service,
+		deploy:   deploy,
+		oldSlot:  service.Version,
+		oldNames: oldNames,
+	}
+
+	running := map[int]bool{}
+	for _, name := range oldNames {
+		running[replicaIndex(name)] = true
+	}
+	for i := 1; i <= r.previous().Replicas; i++ {
+		if !running[i] {
+			r.removedOld = append(r.removedOld, fmt.Sprintf("%s-%s-%d", deploy.ServiceName, service.Version, i))
+		}
+	}
+
+	newNames, err := h.DockerClient.ListBySlot(deploy.ServiceName, deploy.Version)
+	if err != nil {
+		return h.abort(ctx, r, fmt.Errorf("list candidate slot: %w", err))
+	}
+
+	port := utils.ExtractPort(utils.ParseEnvString(deploy.Envs))
+	for _, name := range newNames {
+		if err := h.HealthChecker.Check(ctx, strings.TrimPrefix(name, "/"), port, deploy.HealthCheck); err != nil {
+			return h.abort(ctx, r, fmt.Errorf("candidate unhealthy after restart: %w", err))
+		}
+	}
+
+	// Replicas are created in order, so the candidate runs 1 to newCount.
+	r.newCount = len(newNames)
+
+	if err := h.applyWeights(ctx, r, len(r.oldNames)); err != nil {
+		return h.abort(ctx, r, err)
+	}
+
+	logger.Info(fmt.Sprintf("[Rolling] Resuming %s with %d/%d replicas replaced", deploy.ID, r.newCount, deploy.Replicas))
+	return h.roll(ctx, r)
+}
+
+func (h *Handler) executeRollingUpdate(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	if service.Version == deploy.Version {
+		return fmt.Errorf("version %s is already running for %s", deploy.Version, deploy.ServiceName)
+	}
+
+	oldNames, err := h.DockerClient.ListBySlot(deploy.ServiceName, service.Version)
+	if err != nil {
+		return fmt.Errorf("list current slot: %w", err)
+	}
+
+	r := &rollout{
+		service:  service,
+		deploy:   deploy,
+		oldSlot:  service.Version,
+		oldNames: oldNames,
+	}
+
+	batchSize := utils.GetIntOrDefault(deploy.BatchSize, domain.DefaultBatchSize)
+
+	logger.Info(fmt.Sprintf("[Rolling] Replacing %d replicas of %s-%s with %d replicas of %s (batch=%d, maxUnavailable=%d)",
+		len(oldNames), deploy.ServiceName, r.oldSlot, deploy.Replicas, deploy.Version, batchSize, deploy.MaxUnavailable))
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepCreatingInfra); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	pulled, err := h.DockerClient.EnsureImage(deploy.Image)
+	if err != nil {
+		return fmt.Errorf("ensure image: %w", err)
+	}
+	h.progress.ImageReady(ctx, deploy, pulled)
+
+	if err := h.TraefikClient.EnsureRouter(deploy.Application, deploy.ServiceName, routing.Routes(service)); err != nil {
+		return fmt.Errorf("ensure router: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepSwapTraffic); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	return h.roll(ctx, r)
+}
+
+// roll replaces the old replicas batch by batch until the candidate runs all of them,
+// then points the router at it and records it on the service.
+func (h *Handler) roll(ctx context.Context, r *rollout) error {
+	deploy, service := r.deploy, r.service
+	batchSize := utils.GetIntOrDefault(deploy.BatchSize, domain.DefaultBatchSize)
+	envs := utils.ParseEnvString(deploy.Envs)
+	port := utils.ExtractPort(envs)
+
+	for r.newCount < deploy.Replicas {
+		batch := min(batchSize, deploy.Replicas-r.newCount)
+
+		// Up to maxUnavailable old replicas leave before the batch is started,
+		// so the slot never runs more than batch extra containers.
+		unavailable := min(deploy.MaxUnavailable, batch, len(r.oldNames))
+		if err := h.removeOld(ctx, r, unavailable); err != nil {
+			return h.abort(ctx, r, err)
+		}
+
+		for i := 1; i <= batch; i++ {
+			name, err := h.DockerClient.CreateReplica(deploy.ServiceName, deploy.Version, deploy.Image, r.newCount+i, envs, port, convert.ToDockerHealthCheck(deploy.DockerHealthCheck))
+			if err != nil {
+				return h.abort(ctx, r, fmt.Errorf("create replica: %w", err))
+			}
+			h.progress.ContainersStarted(ctx, deploy, name)
+		}
+
+		for i := 1; i <= batch; i++ {
+			instanceName := fmt.Sprintf("%s-%s-%d", deploy.ServiceName, deploy.Version, r.newCount+i)
+			if err := h.pingReplica(ctx, deploy, instanceName, port); err != nil {
+				return h.abort(ctx, r, fmt.Errorf("healthcheck failed for %s: %w", instanceName, err))
+			}
+		}
+		r.newCount += batch
+
+		if err := h.removeOld(ctx, r, batch-unavailable); err != nil {
+			return h.abort(ctx, r, err)
+		}
+
+		logger.Info(fmt.Sprintf("[Rolling] %d/%d replicas of %s replaced", r.newCount, deploy.Replicas, deploy.ServiceName))
+	}
+
+	if err := h.removeOld(ctx, r, len(r.oldNames)); err != nil {
+		return h.abort(ctx, r, err)
+	}
+
+	if err := h.TraefikClient.PointRouterTo(deploy.Application, deploy.ServiceName, deploy.Version); err != nil {
+		logger.Warn(fmt.Sprintf("[Rolling] Failed to point router: %v", err))
+		return fmt.Errorf("point router failed: %w", err)
+	}
+
+	release.Apply(service, deploy)
+	service.Replicas = deploy.Replicas
+
+	if err := h.db.UpdateService(ctx, *service); err != nil {
+		logger.WithError(err).Error("error on update service")
+		return fmt.Errorf("error update service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinished); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[Rolling] Rollout finished for %s", deploy.ServiceName))
+	return nil
+}
+
+// removeOld takes count replicas of the old slot out of the load balancer and
+// then removes their containers.
+func (h *Handler) removeOld(ctx context.Context, r *rollout, count int) error {
+	count = min(count, len(r.oldNames))
+	remaining := r.oldNames[count:]
+
+	if err := h.applyWeights(ctx, r, len(remaining)); err != nil {
+		return err
+	}
+
+	for _, name := range r.oldNames[:count] {
+		if err := h.DockerClient.RemoveContainer(name); err != nil {
+			return fmt.Errorf("remove replica %s: %w", name, err)
+		}
+		r.removedOld = append(r.removedOld, name)
+	}
+	r.oldNames = remaining
+
+	return nil
+}
+
+// applyWeights splits the traffic between both slots proportionally to their healthy replicas.
+func (h *Handler) applyWeights(ctx context.Context, r *rollout, oldCount int) error {
+	var backends []traefik.WeightedBackend
+	if oldCount > 0 {
+		backends = append(backends, traefik.WeightedBackend{Name: r.deploy.ServiceName + "-" + r.oldSlot, Weight: oldCount})
+	}
+	if r.newCount > 0 {
+		backends = append(backends, traefik.WeightedBackend{Name: r.deploy.ServiceName + "-" + r.deploy.Version, Weight: r.newCount})
+	}
+	if len(backends) == 0 {
+		return nil
+	}
+
+	if err := h.setWeights(ctx, r.deploy, backends); err != nil {
+		return fmt.Errorf("insert weighted: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[Rolling] Candidate weight is %d and Current is %d", r.newCount, oldCount))
+	return nil
+}
+
+// pingReplica waits for a new replica to pass its health check, probed on the address
+// of the container rather than the alias of the slot.
+func (h *Handler) pingReplica(ctx context.Context, deploy *dto.Deployment, instanceName string, port int) error {
+	maxWait := utils.GetIntOrDefault(deploy.MaxWaitTime, domain.DefaultMaxWaitTimeSeconds)
+	ctxPing, cancel := context.WithTimeout(ctx, time.Duration(maxWait)*time.Second)
+	defer cancel()
+
+	interval := utils.GetIntOrDefault(deploy.HealthCheckInterval, domain.DefaultHealthCheckIntervalSeconds)
+	return h.HealthChecker.Ping(ctxPing, instanceName, port, interval, deploy.HealthCheck)
+}
+
+// abort sends the traffic back to the old slot, recreating the replicas that were
+// already replaced, and removes every container of the candidate slot.
+func (h *Handler) abort(ctx context.Context, r *rollout, cause error) error {
+	logger.WithError(cause).Error(fmt.Sprintf("[Rolling] Rollout of %s failed, restoring %s", r.deploy.ServiceName, r.oldSlot))
+
+	previous := r.previous()
+	port := utils.ExtractPort(utils.ParseEnvString(previous.Envs))
+	envs := utils.ParseEnvString(previous.Envs)
+
+	for _, name := range r.removedOld {
+		if _, err := h.DockerClient.CreateReplica(r.deploy.ServiceName, r.oldSlot, previous.Image, replicaIndex(name), envs, port, convert.ToDockerHealthCheck(previous.DockerHealthCheck)); err != nil {
+			logger.WithError(err).Error(fmt.Sprintf("[Rolling] Failed to restore replica %s", name))
+		}
+	}
+
+	if err := h.setWeights(ctx, r.deploy, []traefik.WeightedBackend{
+		{Name: r.deploy.ServiceName + "-" + r.oldSlot, Weight: 100},
+	}); err != nil {
+		logger.WithError(err).Error("[Rolling] Failed to restore weights")
+	}
+
+	if err := h.DockerClient.RemoveSlot(r.deploy.ServiceName, r.deploy.Version); err != nil {
+		logger.WithError(err).Error("[Rolling] Failed to remove candidate slot")
+	} else {
+		h.progress.SlotRemoved(ctx, r.deploy, r.deploy.Version)
+	}
+
+	if err := h.updateDeploymentStep(ctx, r.deploy, domain.StepFailed); err != nil {
+		logger.WithError(err).Error("update deployment step")
+	}
+
+	return cause
+}
+
+// previous is the spec the old slot was started with. The service record may hold the
+// new one already, when the rollout redeploys an updated service.
+func (r *rollout) previous() dto.ServiceSpec {
+	if r.deploy.Previous != nil {
+		return *r.deploy.Previous
+	}
+	return dto.ServiceSpec{
+		Image:             r.service.Image,
+		Replicas:          r.service.Replicas,
+		Envs:              r.service.Envs,
+		DockerHealthCheck: r.service.DockerHealthCheck,
+	}
+}
+
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
+}
+
+func (h *Handler) setWeights(ctx context.Context, deploy *dto.Deployment, backends []traefik.WeightedBackend) error {
+	if err := h.TraefikClient.InsertWeightedService(deploy.Application, deploy.ServiceName, backends); err != nil {
+		return err
+	}
+
+	h.progress.Weights(ctx, deploy, backends)
+	return nil
+}
+
+func replicaIndex(name string) int {
+	idx := strings.LastIndex(name, "-")
+	if idx < 0 {
+		return 1
+	}
+
+	n, err := strconv.Atoi(name[idx+1:])
+	if err != nil {
+		return 1
+	}
+	return n
+}
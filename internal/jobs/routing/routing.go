@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"fmt"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+)
+
+// Routes returns the routers of a service as described by its definition.
+func Routes(service *dto.Service) traefik.ServiceRoutes {
+	return traefik.ServiceRoutes{
+		Rules: rules(service),
+		TLS: traefik.RouterTLSOptions{
+			Enabled:      service.TLS.Enabled,
+			CertResolver: service.TLS.CertResolver,
+			RedirectHTTP: service.TLS.RedirectHTTP,
+		},
+		Middlewares: middlewares(service.Middlewares),
+	}
+}
+
+// rules returns the rules of the routes of a service, or of its hostname when it has
+// no route.
+func rules(service *dto.Service) []traefik.RouterRule {
+	routes := make([]domain.Route, 0, len(service.Routes))
+	for _, r := range service.Routes {
+		routes = append(routes, domain.Route{
+			Hosts:      r.Hosts,
+			PathPrefix: r.PathPrefix,
+			Headers:    r.Headers,
+			Rule:       r.Rule,
+			Priority:   r.Priority,
+		})
+	}
+
+	var rules []traefik.RouterRule
+	for _, route := range domain.ServiceRoutes(service.Name, service.Hostname, routes) {
+		rules = append(rules, traefik.RouterRule{Rule: route.Matcher(), Priority: route.Priority})
+	}
+	return rules
+}
+
+// middlewares renders the middlewares of a service in the order requests go through
+// them: the ones turning requests away first, the ones rewriting them last.
+func middlewares(m dto.Middlewares) []traefik.RouterMiddleware {
+	var out []traefik.RouterMiddleware
+	add := func(name string, middleware traefik.Middleware) {
+		out = append(out, traefik.RouterMiddleware{Name: name, Middleware: middleware})
+	}
+
+	if len(m.IPAllowList) > 0 {
+		add("ipallowlist", traefik.Middleware{IPAllowList: &traefik.IPAllowList{SourceRange: m.IPAllowList}})
+	}
+
+	if m.BasicAuth != nil {
+		add("basicauth", traefik.Middleware{BasicAuth: &traefik.BasicAuth{Users: m.BasicAuth.Users, Realm: m.BasicAuth.Realm}})
+	}
+
+	if r := m.RateLimit; r != nil {
+		rateLimit := &traefik.RateLimit{Average: r.Average, Burst: r.Burst}
+		if r.PeriodSeconds > 0 {
+			rateLimit.Period = fmt.Sprintf("%ds", r.PeriodSeconds)
+		}
+		add("ratelimit", traefik.Middleware{RateLimit: rateLimit})
+	}
+
+	if m.CircuitBreaker != "" {
+		add("circuitbreaker", traefik.Middleware{CircuitBreaker: &traefik.CircuitBreaker{Expression: m.CircuitBreaker}})
+	}
+
+	if r := m.Retry; r != nil {
+		retry := &traefik.Retry{Attempts: r.Attempts}
+		if r.InitialIntervalMs > 0 {
+			retry.InitialInterval = fmt.Sprintf("%dms", r.InitialIntervalMs)
+		}
+		add("retry", traefik.Middleware{Retry: retry})
+	}
+
+	if h := m.Headers; h != nil {
+		add("headers", traefik.Middleware{Headers: &traefik.Headers{
+			CustomRequestHeaders:          h.CustomRequestHeaders,
+			CustomResponseHeaders:         h.CustomResponseHeaders,
+			AccessControlAllowOriginList:  h.AccessControlAllowOrigins,
+			AccessControlAllowMethods:     h.AccessControlAllowMethods,
+			AccessControlAllowHeaders:     h.AccessControlAllowHeaders,
+			AccessControlAllowCredentials: h.AccessControlAllowCredentials,
+			AccessControlMaxAge:           h.AccessControlMaxAge,
+			STSSeconds:                    h.STSSeconds,
+			FrameDeny:                     h.FrameDeny,
+			ContentTypeNosniff:            h.ContentTypeNosniff,
+			BrowserXSSFilter:              h.BrowserXSSFilter,
+			ReferrerPolicy:                h.ReferrerPolicy,
+		}})
+	}
+
+	if len(m.StripPrefix) > 0 {
+		add("stripprefix", traefik.Middleware{StripPrefix: &traefik.StripPrefix{Prefixes: m.StripPrefix}})
+	}
+
+	if m.Compress {
+		add("compress", traefik.Middleware{Compress: &traefik.Compress{}})
+	}
+
+	return out
+}
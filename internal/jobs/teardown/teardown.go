@@ -0,0 +1,111 @@
+package teardown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/docker"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+	"github.com/elissonalvesilva/releasy/pkg/logger"
+)
+
+type Handler struct {
+	DockerClient  docker.DockerClient
+	TraefikClient traefik.TraefikInterface
+	db            store.DbStore
+	progress      *progress.Reporter
+}
+
+func New(
+	dockerClient docker.DockerClient,
+	traefikClient traefik.TraefikInterface,
+	db store.DbStore,
+	reporter *progress.Reporter,
+) *Handler {
+	return &Handler{
+		DockerClient:  dockerClient,
+		TraefikClient: traefikClient,
+		db:            db,
+		progress:      reporter,
+	}
+}
+
+func (h *Handler) Run(ctx context.Context, deploy *dto.Deployment) error {
+	switch deploy.Action {
+	case domain.ActionServiceDelete:
+		return h.executeTeardown(ctx, deploy)
+	default:
+		return fmt.Errorf("invalid action: %s", deploy.Action)
+	}
+}
+
+// Resume runs an interrupted teardown again, as every step of it can be repeated.
+func (h *Handler) Resume(ctx context.Context, deploy *dto.Deployment) error {
+	return h.Run(ctx, deploy)
+}
+
+func (h *Handler) executeTeardown(ctx context.Context, deploy *dto.Deployment) error {
+	service, err := h.db.GetService(ctx, deploy.Application, deploy.ServiceName)
+	if errors.Is(err, store.ErrNotFound) && deploy.Step == domain.StepRemoving {
+		// The record is deleted last, so an earlier attempt got through everything else.
+		return h.updateDeploymentStep(ctx, deploy, domain.StepFinished)
+	}
+	if err != nil {
+		logger.WithError(err).Error("error on get service")
+		return fmt.Errorf("get service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepRemoving); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	slots, err := h.TraefikClient.GetSlots(deploy.Application, deploy.ServiceName)
+	if err != nil {
+		logger.WithError(err).Warn(fmt.Sprintf("[Teardown] Failed to read slots of %s from traefik", deploy.ServiceName))
+	}
+	slots = appendUnique(slots, service.Version)
+
+	for _, slot := range slots {
+		logger.Info(fmt.Sprintf("[Teardown] Removing slot %s-%s", deploy.ServiceName, slot))
+		if err := h.DockerClient.RemoveSlot(deploy.ServiceName, slot); err != nil {
+			return fmt.Errorf("remove slot %s: %w", slot, err)
+		}
+		h.progress.SlotRemoved(ctx, deploy, slot)
+	}
+
+	if err := h.TraefikClient.RemoveService(deploy.Application, deploy.ServiceName); err != nil {
+		return fmt.Errorf("remove traefik service: %w", err)
+	}
+
+	if err := h.db.DeleteService(ctx, deploy.Application, deploy.ServiceName); err != nil {
+		logger.WithError(err).Error("error on delete service")
+		return fmt.Errorf("delete service: %w", err)
+	}
+
+	if err := h.updateDeploymentStep(ctx, deploy, domain.StepFinished); err != nil {
+		logger.WithError(err).Error("update deployment step")
+		return fmt.Errorf("update deployment step: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("[Teardown] Service %s/%s removed", deploy.Application, deploy.ServiceName))
+	return nil
+}
+
+func (h *Handler) updateDeploymentStep(ctx context.Context, deploy *dto.Deployment, step string) error {
+	return h.progress.Step(ctx, deploy, step)
+}
+
+func appendUnique(slots []string, slot string) []string {
+	for _, s := range slots {
+		if s == slot {
+			return slots
+		}
+	}
+	return append(slots, slot)
+}
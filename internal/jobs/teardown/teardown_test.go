@@ -0,0 +1,108 @@
+package teardown
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/elissonalvesilva/releasy/internal/core/domain"
+	"github.com/elissonalvesilva/releasy/internal/core/dto"
+	"github.com/elissonalvesilva/releasy/internal/fakes"
+	"github.com/elissonalvesilva/releasy/internal/jobs/progress"
+	"github.com/elissonalvesilva/releasy/internal/store"
+	"github.com/elissonalvesilva/releasy/internal/traefik"
+)
+
+func TestHandlerResume(t *testing.T) {
+	tests := []struct {
+		name        string
+		step        string
+		deleted     bool
+		wantErr     bool
+		wantStep    string
+		wantRemoved bool
+	}{
+		{
+			name:        "creating runs the teardown",
+			step:        domain.StepCreating,
+			wantStep:    domain.StepFinished,
+			wantRemoved: true,
+		},
+		{
+			name:        "removing runs it again",
+			step:        domain.StepRemoving,
+			wantStep:    domain.StepFinished,
+			wantRemoved: true,
+		},
+		{
+			name:     "removing after the record was deleted",
+			step:     domain.StepRemoving,
+			deleted:  true,
+			wantStep: domain.StepFinished,
+		},
+		{
+			name:     "service gone before the teardown started",
+			step:     domain.StepCreating,
+			deleted:  true,
+			wantErr:  true,
+			wantStep: domain.StepCreating,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := fakes.NewStore()
+			docker := fakes.NewDocker()
+			traefikClient := fakes.NewTraefik()
+
+			if !tt.deleted {
+				db.AddService(dto.Service{Application: "shop", Name: "api", Version: "v1", Replicas: 2})
+			}
+			docker.AddSlot("api", "v1", 2)
+			docker.AddSlot("api", "v2", 1)
+			if err := traefikClient.EnsureRouter("shop", "api", traefik.ServiceRoutes{}); err != nil {
+				t.Fatal(err)
+			}
+			if err := traefikClient.InsertWeightedService("shop", "api", []traefik.WeightedBackend{
+				{Name: "api-v1", Weight: 80},
+				{Name: "api-v2", Weight: 20},
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			deploy := &dto.Deployment{
+				ID:                 "d1",
+				Application:        "shop",
+				ServiceName:        "api",
+				DeploymentStrategy: domain.StrategyTeardown,
+				Version:            "v1",
+				Action:             domain.ActionServiceDelete,
+				Step:               tt.step,
+			}
+			if err := db.SaveDeployment(context.Background(), *deploy); err != nil {
+				t.Fatal(err)
+			}
+
+			h := New(docker, traefikClient, db, progress.New(db, fakes.NewStreams()))
+			err := h.Resume(context.Background(), deploy)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := db.Step("d1"); got != tt.wantStep {
+				t.Errorf("step = %q, want %q", got, tt.wantStep)
+			}
+			if _, err := db.GetService(context.Background(), "shop", "api"); !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("service still recorded: %v", err)
+			}
+			if slots, _ := traefikClient.GetSlots("shop", "api"); (len(slots) == 0) != tt.wantRemoved {
+				t.Errorf("traefik slots = %v, want removed %v", slots, tt.wantRemoved)
+			}
+			for _, slot := range []string{"v1", "v2"} {
+				if removed := len(docker.Slot("api", slot)) == 0; removed != tt.wantRemoved {
+					t.Errorf("slot %s removed = %v, want %v", slot, removed, tt.wantRemoved)
+				}
+			}
+		})
+	}
+}
@@ -36,3 +36,49 @@ CREATE TABLE IF NOT EXISTS events (
     message TEXT,
     created_at TIMESTAMP
 );
+
+
+CREATE TABLE IF NOT EXISTS deployment_steps (
+    id BIGSERIAL PRIMARY KEY,
+    deployment_id TEXT REFERENCES deployments(id) ON DELETE CASCADE,
+    step VARCHAR(20),
+    created_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS deployment_steps_deployment_id_idx ON deployment_steps (deployment_id);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS strategy VARCHAR(20) DEFAULT 'blue_green';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS health_check JSONB DEFAULT '{}';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS docker_health_check JSONB DEFAULT '{}';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS routes JSONB DEFAULT '[]';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS tls JSONB DEFAULT '{}';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS tls_cert TEXT DEFAULT '';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS tls_key TEXT DEFAULT '';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS middlewares JSONB DEFAULT '{}';
+
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS owner VARCHAR(100) DEFAULT '';
+ALTER TABLE deployments ADD COLUMN IF NOT EXISTS payload JSONB DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS deployments_owner_idx ON deployments (owner);
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS deployment_id TEXT DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS type VARCHAR(50) DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS details JSONB DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS events_deployment_id_idx ON events (deployment_id);
+CREATE INDEX IF NOT EXISTS events_service_idx ON events (application, service_name);
+
+-- A service runs one deployment at a time; configure jobs only rewrite its routers and
+-- run alongside. Deployments left in flight next to a newer one are failed first, as
+-- the index cannot be built over them.
+UPDATE deployments d SET step = 'failed'
+WHERE d.strategy <> 'configure' AND d.step NOT IN ('finished', 'failed', 'rollback', 'cancelled')
+  AND EXISTS (
+    SELECT 1 FROM deployments n
+    WHERE n.application = d.application AND n.service_name = d.service_name
+      AND n.strategy <> 'configure' AND n.step NOT IN ('finished', 'failed', 'rollback', 'cancelled')
+      AND (n.created_at, n.id) > (d.created_at, d.id)
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS deployments_active_idx ON deployments (application, service_name)
+WHERE strategy <> 'configure' AND step NOT IN ('finished', 'failed', 'rollback', 'cancelled');
@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/lib/pq"
+	"strings"
 	"time"
 
 	"github.com/elissonalvesilva/releasy/internal/core/dto"
@@ -27,16 +30,25 @@ type DbStore interface {
 	DeleteOldDeployments(ctx context.Context, serviceName string, keepLast int) error
 	UpdateDeploymentStep(ctx context.Context, id string, step string) error
 	GetDeploymentByID(ctx context.Context, id string) (*Deployment, error)
+	ListDeployments(ctx context.Context, filter DeploymentFilter) ([]Deployment, int, error)
+	GetDeploymentSteps(ctx context.Context, deploymentIDs ...string) ([]DeploymentStep, error)
+	ClaimDeployment(ctx context.Context, id, owner, payload string) error
+	ListOwnedDeployments(ctx context.Context, owner string, excludeSteps []string) ([]Deployment, error)
+	GetActiveDeployment(ctx context.Context, application, serviceName string, excludeSteps []string) (*Deployment, error)
+	ListStaleDeployments(ctx context.Context, step string, before time.Time) ([]Deployment, error)
 
 	SaveService(ctx context.Context, s dto.Service) error
 	GetServices(ctx context.Context, serviceName string) ([]dto.Service, error)
+	ListServices(ctx context.Context, application string) ([]dto.Service, error)
 	GetService(ctx context.Context, application, serviceName string) (*dto.Service, error)
 	DeleteService(ctx context.Context, application, serviceName string) error
 	GetServiceByName(ctx context.Context, serviceName string) (*dto.Service, error)
 	UpdateService(ctx context.Context, s dto.Service) error
+	SetServiceCertificate(ctx context.Context, application, serviceName string, cert *dto.Certificate) error
 
 	SaveEvent(ctx context.Context, e Event) error
-	GetEvents(ctx context.Context, serviceName string, limit int) ([]Event, error)
+	GetEvents(ctx context.Context, application, serviceName string, limit int) ([]Event, error)
+	GetDeploymentEvents(ctx context.Context, deploymentID string) ([]Event, error)
 }
 
 type Deployment struct {
@@ -50,34 +62,67 @@ type Deployment struct {
 	Action      string    `db:"action"`
 	Step        string    `db:"step"`
 	Envs        string    `db:"envs"`
+	Owner       string    `db:"owner"`
+	Payload     string    `db:"payload"`
 	CreatedAt   time.Time `db:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at"`
 }
 
+type DeploymentStep struct {
+	ID           int64     `db:"id"`
+	DeploymentID string    `db:"deployment_id"`
+	Step         string    `db:"step"`
+	CreatedAt    time.Time `db:"created_at"`
+}
+
+type DeploymentFilter struct {
+	Application string
+	ServiceName string
+	Strategy    string
+	Step        string
+	Version     string
+	Limit       int
+	Offset      int
+}
+
 type Service struct {
-	ID          string    `db:"id"`
-	Application string    `db:"application"`
-	Name        string    `db:"name"`
-	Version     string    `db:"version"`
-	Image       string    `db:"image"`
-	Replicas    int       `db:"replicas"`
-	Envs        string    `db:"envs"`
-	Weight      int       `db:"weight"`
-	Hostname    string    `db:"hostname"`
-	CreatedAt   time.Time `db:"created_at"`
+	ID                string    `db:"id"`
+	Application       string    `db:"application"`
+	Name              string    `db:"name"`
+	Version           string    `db:"version"`
+	Image             string    `db:"image"`
+	Replicas          int       `db:"replicas"`
+	Envs              string    `db:"envs"`
+	Weight            int       `db:"weight"`
+	Hostname          string    `db:"hostname"`
+	Strategy          string    `db:"strategy"`
+	HealthCheck       string    `db:"health_check"`
+	DockerHealthCheck string    `db:"docker_health_check"`
+	Routes            string    `db:"routes"`
+	TLS               string    `db:"tls"`
+	Middlewares       string    `db:"middlewares"`
+	TLSCert           string    `db:"tls_cert"`
+	TLSKey            string    `db:"tls_key"`
+	CreatedAt         time.Time `db:"created_at"`
 }
 
 type Event struct {
-	ID          string    `db:"id"`
-	Application string    `db:"application"`
-	ServiceName string    `db:"service_name"`
-	Message     string    `db:"message"`
-	CreatedAt   time.Time `db:"created_at"`
+	ID           string    `db:"id"`
+	Application  string    `db:"application"`
+	ServiceName  string    `db:"service_name"`
+	Message      string    `db:"message"`
+	CreatedAt    time.Time `db:"created_at"`
+	DeploymentID string    `db:"deployment_id"`
+	Type         string    `db:"type"`
+	Details      string    `db:"details"`
 }
 
 var (
 	ErrServiceAlreadyExists = errors.New("service already exists")
 	ErrNotFound             = errors.New("not found result")
+	// ErrActiveDeployment is returned when a deployment is saved for a service that has
+	// one in flight already.
+	ErrActiveDeployment = errors.New("service has a deployment in flight")
 )
 
 func NewPgStore(dsn string) (*PgStore, error) {
@@ -98,6 +143,8 @@ func (s *PgStore) InitSchema(ctx context.Context) error {
 	return err
 }
 
+// SaveDeployment records a deployment and its first step. It fails with
+// ErrActiveDeployment while another deployment of the service is in flight.
 func (s *PgStore) SaveDeployment(ctx context.Context, d dto.Deployment) error {
 	query := `
 		INSERT INTO deployments (
@@ -110,8 +157,21 @@ func (s *PgStore) SaveDeployment(ctx context.Context, d dto.Deployment) error {
 	`
 	model := s.toModel(d)
 
-	_, err := s.DB.NamedExecContext(ctx, query, model)
-	return err
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.NamedExecContext(ctx, query, model); err != nil {
+		return activeDeploymentError(err)
+	}
+
+	if err := s.insertDeploymentStep(ctx, tx, model.ID, model.Step, model.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (s *PgStore) GetDeployments(ctx context.Context, serviceName string, limit int) ([]Deployment, error) {
@@ -141,8 +201,31 @@ func (s *PgStore) DeleteOldDeployments(ctx context.Context, serviceName string,
 }
 
 func (s *PgStore) UpdateDeploymentStep(ctx context.Context, id string, step string) error {
-	query := `UPDATE deployments SET step = $1 WHERE id = $2`
-	_, err := s.DB.ExecContext(ctx, query, step, id)
+	tx, err := s.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	query := `UPDATE deployments SET step = $1, updated_at = $2 WHERE id = $3`
+	if _, err := tx.ExecContext(ctx, query, step, now, id); err != nil {
+		return activeDeploymentError(err)
+	}
+
+	if err := s.insertDeploymentStep(ctx, tx, id, step, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// activeDeploymentError turns a violation of the index of active deployments, which
+// lets a service have a single deployment in flight, into ErrActiveDeployment.
+func activeDeploymentError(err error) error {
+	if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" && pgErr.Constraint == "deployments_active_idx" {
+		return ErrActiveDeployment
+	}
 	return err
 }
 
@@ -159,18 +242,153 @@ func (s *PgStore) GetDeploymentByID(ctx context.Context, id string) (*Deployment
 	return &d, nil
 }
 
+func (s *PgStore) ListDeployments(ctx context.Context, filter DeploymentFilter) ([]Deployment, int, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	addCondition := func(column, value string) {
+		if value == "" {
+			return
+		}
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	addCondition("application", filter.Application)
+	addCondition("service_name", filter.ServiceName)
+	addCondition("strategy", filter.Strategy)
+	addCondition("step", filter.Step)
+	addCondition("version", filter.Version)
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	countQuery := fmt.Sprintf(`SELECT COUNT(*) FROM deployments %s`, where)
+	if err := s.DB.GetContext(ctx, &total, countQuery, args...); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, filter.Limit, filter.Offset)
+	query := fmt.Sprintf(`
+		SELECT * FROM deployments
+		%s
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`, where, len(args)-1, len(args))
+
+	var deploys []Deployment
+	if err := s.DB.SelectContext(ctx, &deploys, query, args...); err != nil {
+		return nil, 0, err
+	}
+
+	return deploys, total, nil
+}
+
+func (s *PgStore) GetDeploymentSteps(ctx context.Context, deploymentIDs ...string) ([]DeploymentStep, error) {
+	var steps []DeploymentStep
+	query := `SELECT * FROM deployment_steps WHERE deployment_id = ANY($1) ORDER BY created_at, id`
+	err := s.DB.SelectContext(ctx, &steps, query, pq.Array(deploymentIDs))
+	return steps, err
+}
+
+// ClaimDeployment records the agent running the deployment and the job it is running,
+// so that another start of that agent can pick the deployment up again.
+func (s *PgStore) ClaimDeployment(ctx context.Context, id, owner, payload string) error {
+	query := `UPDATE deployments SET owner = $1, payload = $2, updated_at = $3 WHERE id = $4`
+	_, err := s.DB.ExecContext(ctx, query, owner, payload, time.Now(), id)
+	return err
+}
+
+func (s *PgStore) ListOwnedDeployments(ctx context.Context, owner string, excludeSteps []string) ([]Deployment, error) {
+	var deploys []Deployment
+	query := `
+		SELECT * FROM deployments
+		WHERE owner = $1 AND step <> ALL($2)
+		ORDER BY created_at
+	`
+	err := s.DB.SelectContext(ctx, &deploys, query, owner, pq.Array(excludeSteps))
+	return deploys, err
+}
+
+// GetActiveDeployment returns the latest deployment of a service that is not in one of excludeSteps.
+func (s *PgStore) GetActiveDeployment(ctx context.Context, application, serviceName string, excludeSteps []string) (*Deployment, error) {
+	var d Deployment
+	query := `
+		SELECT * FROM deployments
+		WHERE application = $1 AND service_name = $2 AND step <> ALL($3)
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+	err := s.DB.GetContext(ctx, &d, query, application, serviceName, pq.Array(excludeSteps))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListStaleDeployments returns the deployments that have not changed since before while in step.
+func (s *PgStore) ListStaleDeployments(ctx context.Context, step string, before time.Time) ([]Deployment, error) {
+	var deploys []Deployment
+	query := `
+		SELECT * FROM deployments
+		WHERE step = $1 AND updated_at < $2
+		ORDER BY updated_at
+	`
+	err := s.DB.SelectContext(ctx, &deploys, query, step, before)
+	return deploys, err
+}
+
+func (s *PgStore) insertDeploymentStep(ctx context.Context, tx *sqlx.Tx, deploymentID, step string, createdAt time.Time) error {
+	query := `INSERT INTO deployment_steps (deployment_id, step, created_at) VALUES ($1, $2, $3)`
+	_, err := tx.ExecContext(ctx, query, deploymentID, step, createdAt)
+	return err
+}
+
 // services
 
 func (s *PgStore) SaveService(ctx context.Context, svc dto.Service) error {
+	healthCheck, err := json.Marshal(svc.HealthCheck)
+	if err != nil {
+		return err
+	}
+
+	dockerHealthCheck, err := json.Marshal(svc.DockerHealthCheck)
+	if err != nil {
+		return err
+	}
+
+	routes, err := json.Marshal(svc.Routes)
+	if err != nil {
+		return err
+	}
+
+	tlsOptions, err := json.Marshal(svc.TLS)
+	if err != nil {
+		return err
+	}
+
+	middlewares, err := json.Marshal(svc.Middlewares)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO services (id, application, name, version, image, replicas, envs, weight, hostname, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO services (id, application, name, version, image, replicas, envs, weight, hostname, strategy, health_check, docker_health_check, routes, tls, middlewares, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 		ON CONFLICT (application, name) DO UPDATE
-		SET image = EXCLUDED.image, replicas = EXCLUDED.replicas, envs = EXCLUDED.envs, weight = EXCLUDED.weight, hostname = EXCLUDED.hostname, created_at = EXCLUDED.created_at
+		SET image = EXCLUDED.image, replicas = EXCLUDED.replicas, envs = EXCLUDED.envs, weight = EXCLUDED.weight, hostname = EXCLUDED.hostname, strategy = EXCLUDED.strategy, health_check = EXCLUDED.health_check, docker_health_check = EXCLUDED.docker_health_check, routes = EXCLUDED.routes, tls = EXCLUDED.tls, middlewares = EXCLUDED.middlewares, created_at = EXCLUDED.created_at
 	`
 
-	_, err := s.DB.ExecContext(ctx, query,
-		svc.ID, svc.Application, svc.Name, svc.Version, svc.Image, svc.Replicas, svc.Envs, svc.Weight, svc.Hostname, svc.CreatedAt)
+	_, err = s.DB.ExecContext(ctx, query,
+		svc.ID, svc.Application, svc.Name, svc.Version, svc.Image, svc.Replicas, svc.Envs, svc.Weight, svc.Hostname, svc.Strategy, string(healthCheck), string(dockerHealthCheck), string(routes), string(tlsOptions), string(middlewares), svc.CreatedAt)
 
 	if err != nil {
 		if pgErr, ok := err.(*pq.Error); ok && pgErr.Code == "23505" {
@@ -196,6 +414,20 @@ func (s *PgStore) GetServices(ctx context.Context, serviceName string) ([]dto.Se
 	return servicesDTO, nil
 }
 
+func (s *PgStore) ListServices(ctx context.Context, application string) ([]dto.Service, error) {
+	var services []Service
+	query := `SELECT * FROM services WHERE $1 = '' OR application = $1 ORDER BY application, name`
+	if err := s.DB.SelectContext(ctx, &services, query, application); err != nil {
+		return nil, err
+	}
+
+	servicesDTO := make([]dto.Service, 0, len(services))
+	for _, service := range services {
+		servicesDTO = append(servicesDTO, s.toServiceDTO(service))
+	}
+	return servicesDTO, nil
+}
+
 func (s *PgStore) GetService(ctx context.Context, application, serviceName string) (*dto.Service, error) {
 	var svc Service
 	query := `SELECT * FROM services WHERE name = $1 AND application = $2`
@@ -231,23 +463,82 @@ func (s *PgStore) DeleteService(ctx context.Context, application, serviceName st
 }
 
 func (s *PgStore) UpdateService(ctx context.Context, svc dto.Service) error {
-	query := `UPDATE services SET image = $1, replicas = $2, envs = $3, weight = $4, hostname = $5, created_at = $6, version = $7 WHERE name = $8 AND application = $9`
-	_, err := s.DB.ExecContext(ctx, query, svc.Image, svc.Replicas, svc.Envs, svc.Weight, svc.Hostname, svc.CreatedAt, svc.Version, svc.Name, svc.Application)
+	healthCheck, err := json.Marshal(svc.HealthCheck)
+	if err != nil {
+		return err
+	}
+
+	dockerHealthCheck, err := json.Marshal(svc.DockerHealthCheck)
+	if err != nil {
+		return err
+	}
+
+	routes, err := json.Marshal(svc.Routes)
+	if err != nil {
+		return err
+	}
+
+	tlsOptions, err := json.Marshal(svc.TLS)
+	if err != nil {
+		return err
+	}
+
+	middlewares, err := json.Marshal(svc.Middlewares)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE services SET image = $1, replicas = $2, envs = $3, weight = $4, hostname = $5, created_at = $6, version = $7, strategy = $8, health_check = $9, docker_health_check = $10, routes = $11, tls = $12, middlewares = $13 WHERE name = $14 AND application = $15`
+	_, err = s.DB.ExecContext(ctx, query, svc.Image, svc.Replicas, svc.Envs, svc.Weight, svc.Hostname, svc.CreatedAt, svc.Version, svc.Strategy, string(healthCheck), string(dockerHealthCheck), string(routes), string(tlsOptions), string(middlewares), svc.Name, svc.Application)
 	return err
 }
 
+// SetServiceCertificate stores the certificate uploaded for a service, or removes it
+// when cert is nil.
+func (s *PgStore) SetServiceCertificate(ctx context.Context, application, serviceName string, cert *dto.Certificate) error {
+	var certPEM, keyPEM string
+	if cert != nil {
+		certPEM, keyPEM = cert.Cert, cert.Key
+	}
+
+	query := `UPDATE services SET tls_cert = $1, tls_key = $2 WHERE name = $3 AND application = $4`
+	res, err := s.DB.ExecContext(ctx, query, certPEM, keyPEM, serviceName, application)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 /// events
 
 func (s *PgStore) SaveEvent(ctx context.Context, e Event) error {
-	query := `INSERT INTO events (id, application, service_name, message, created_at) VALUES ($1, $2, $3, $4)`
-	_, err := s.DB.ExecContext(ctx, query, e.ID, e.Application, e.ServiceName, e.Message, e.CreatedAt)
+	query := `
+		INSERT INTO events (id, application, service_name, deployment_id, type, message, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`
+	_, err := s.DB.ExecContext(ctx, query, e.ID, e.Application, e.ServiceName, e.DeploymentID, e.Type, e.Message, e.Details, e.CreatedAt)
 	return err
 }
 
-func (s *PgStore) GetEvents(ctx context.Context, serviceName string, limit int) ([]Event, error) {
+func (s *PgStore) GetEvents(ctx context.Context, application, serviceName string, limit int) ([]Event, error) {
+	var events []Event
+	query := `SELECT * FROM events WHERE application = $1 AND service_name = $2 ORDER BY created_at DESC LIMIT $3`
+	err := s.DB.SelectContext(ctx, &events, query, application, serviceName, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (s *PgStore) GetDeploymentEvents(ctx context.Context, deploymentID string) ([]Event, error) {
 	var events []Event
-	query := `SELECT * FROM events WHERE service_name = $1 ORDER BY created_at DESC LIMIT $2`
-	err := s.DB.SelectContext(ctx, &events, query, serviceName, limit)
+	query := `SELECT * FROM events WHERE deployment_id = $1 ORDER BY created_at`
+	err := s.DB.SelectContext(ctx, &events, query, deploymentID)
 	if err != nil {
 		return nil, err
 	}
@@ -272,16 +563,45 @@ func (s *PgStore) toModel(d dto.Deployment) Deployment {
 }
 
 func (s *PgStore) toServiceDTO(service Service) dto.Service {
+	// A spec that cannot be read leaves the defaults of the checker.
+	var healthCheck dto.HealthCheck
+	_ = json.Unmarshal([]byte(service.HealthCheck), &healthCheck)
+
+	var dockerHealthCheck dto.DockerHealthCheck
+	_ = json.Unmarshal([]byte(service.DockerHealthCheck), &dockerHealthCheck)
+
+	var routes []dto.Route
+	_ = json.Unmarshal([]byte(service.Routes), &routes)
+
+	var tlsOptions dto.TLS
+	_ = json.Unmarshal([]byte(service.TLS), &tlsOptions)
+
+	var middlewares dto.Middlewares
+	_ = json.Unmarshal([]byte(service.Middlewares), &middlewares)
+
+	var certificate *dto.Certificate
+	if service.TLSCert != "" {
+		certificate = &dto.Certificate{Cert: service.TLSCert, Key: service.TLSKey}
+	}
+
 	return dto.Service{
-		ID:          service.ID,
-		Application: service.Application,
-		Name:        service.Name,
-		Version:     service.Version,
-		Image:       service.Image,
-		Replicas:    service.Replicas,
-		Envs:        service.Envs,
-		Weight:      service.Weight,
-		Hostname:    service.Hostname,
-		CreatedAt:   service.CreatedAt,
+		ID:                service.ID,
+		Application:       service.Application,
+		Name:              service.Name,
+		Version:           service.Version,
+		Image:             service.Image,
+		Replicas:          service.Replicas,
+		Envs:              service.Envs,
+		Weight:            service.Weight,
+		Hostname:          service.Hostname,
+		Strategy:          service.Strategy,
+		HealthCheck:       healthCheck,
+		DockerHealthCheck: dockerHealthCheck,
+		Routes:            routes,
+		TLS:               tlsOptions,
+		Middlewares:       middlewares,
+		Certificate:       certificate,
+		HasCertificate:    certificate != nil,
+		CreatedAt:         service.CreatedAt,
 	}
 }
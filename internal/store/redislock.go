@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Locker serializes the deployments of a service across every agent.
+type Locker interface {
+	AcquireServiceLock(application, serviceName, owner string, ttl time.Duration) (bool, error)
+	RefreshServiceLock(application, serviceName, owner string, ttl time.Duration) (bool, error)
+	ReleaseServiceLock(application, serviceName, owner string) error
+}
+
+var (
+	refreshLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+	releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+func serviceLockKey(application, serviceName string) string {
+	return fmt.Sprintf("releasy:locks:%s:%s", application, serviceName)
+}
+
+// AcquireServiceLock takes the lock of a service for owner, unless anyone holds it
+// already. Owners are given per attempt, so that two deliveries of the same job are
+// not run at the same time.
+func (s *StreamsStore) AcquireServiceLock(application, serviceName, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.Client.SetNX(ctx, serviceLockKey(application, serviceName), owner, ttl).Result()
+}
+
+// RefreshServiceLock extends the lock of a service while owner still holds it.
+func (s *StreamsStore) RefreshServiceLock(application, serviceName, owner string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	n, err := refreshLockScript.Run(ctx, s.Client, []string{serviceLockKey(application, serviceName)}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseServiceLock gives the lock of a service up, unless another owner took it over.
+func (s *StreamsStore) ReleaseServiceLock(application, serviceName, owner string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return releaseLockScript.Run(ctx, s.Client, []string{serviceLockKey(application, serviceName)}, owner).Err()
+}
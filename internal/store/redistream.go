@@ -2,6 +2,8 @@ package store
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,8 +15,93 @@ type StreamsStore struct {
 
 type Streams interface {
 	PublishJob(stream string, payload map[string]interface{}) error
-	ReadJob(stream, group, consumer string, block time.Duration) ([]redis.XMessage, error)
+	EnsureGroup(stream, group string) error
+	ReadJobs(streams []string, group, consumer string, block time.Duration) ([]redis.XStream, error)
 	AckJob(stream, group, id string) error
+	TouchJob(stream, group, consumer, id string) error
+	ReclaimJobs(stream, group, consumer string, minIdle time.Duration, count int64) ([]PendingJob, error)
+	DeadLetterJob(group string, job PendingJob, reason string) error
+	ListDeadLetters(stream string, count int64) ([]redis.XMessage, error)
+	GetDeadLetter(stream, id string) (*redis.XMessage, error)
+	RequeueDeadLetter(stream, id string) (string, error)
+	Publish(channel string, payload string) error
+	Subscribe(ctx context.Context, channel string) (<-chan *redis.Message, func() error, error)
+}
+
+// PendingJob is a stream entry that was delivered before and never acknowledged.
+type PendingJob struct {
+	Stream     string
+	Message    redis.XMessage
+	Deliveries int64
+}
+
+const DefaultJobStream = "releasy_jobs"
+
+// JobStreams routes the jobs of each application to its stream, so one busy
+// application does not hold back the jobs of the others.
+type JobStreams struct {
+	Default      string
+	Applications map[string]string
+}
+
+// ParseJobStreams builds the routing from the default stream and a list of
+// application=stream pairs separated by commas. The control plane and the agents read
+// them from RELEASY_STREAM and RELEASY_APPLICATION_STREAMS and must share the same
+// values, or jobs are published on streams no agent reads.
+func ParseJobStreams(defaultStream, applications string) (JobStreams, error) {
+	streams := JobStreams{Default: defaultStream, Applications: map[string]string{}}
+	if streams.Default == "" {
+		streams.Default = DefaultJobStream
+	}
+
+	for _, pair := range strings.Split(applications, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		app, stream, ok := strings.Cut(pair, "=")
+		if !ok || app == "" || stream == "" {
+			return JobStreams{}, fmt.Errorf("invalid application stream %q, expected application=stream", pair)
+		}
+		streams.Applications[app] = stream
+	}
+
+	return streams, nil
+}
+
+// For returns the stream the jobs of application are published on.
+func (j JobStreams) For(application string) string {
+	if stream, ok := j.Applications[application]; ok {
+		return stream
+	}
+	return j.Default
+}
+
+// All returns every stream of the routing, the default one first.
+func (j JobStreams) All() []string {
+	all := []string{j.Default}
+	seen := map[string]bool{j.Default: true}
+	for _, stream := range j.Applications {
+		if !seen[stream] {
+			seen[stream] = true
+			all = append(all, stream)
+		}
+	}
+	return all
+}
+
+// DeadLetterStream is the stream where the jobs of stream that could not be processed are parked.
+func DeadLetterStream(stream string) string {
+	return stream + ":dead"
+}
+
+// ControlChannel is the pub/sub channel where every agent listens for control messages.
+const ControlChannel = "releasy:control"
+
+// DeploymentChannel is the pub/sub channel where the progress of a deployment is published.
+func DeploymentChannel(deploymentID string) string {
+	return "releasy:deployments:" + deploymentID
 }
 
 func NewStreamsStore(addr string) *StreamsStore {
@@ -35,29 +122,199 @@ func (s *StreamsStore) PublishJob(stream string, payload map[string]interface{})
 	return err
 }
 
-func (s *StreamsStore) ReadJob(stream, group, consumer string, block time.Duration) ([]redis.XMessage, error) {
+// EnsureGroup creates group on stream, and the stream itself when missing. An existing
+// group is left untouched.
+func (s *StreamsStore) EnsureGroup(stream, group string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := s.Client.XGroupCreateMkStream(ctx, stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// ReadJobs reads new entries from every stream, at most one per stream, so that
+// each stream gets a turn on every read.
+func (s *StreamsStore) ReadJobs(streams []string, group, consumer string, block time.Duration) ([]redis.XStream, error) {
 	ctx := context.Background()
-	res, err := s.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
+
+	args := make([]string, 0, len(streams)*2)
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
+
+	return s.Client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    group,
 		Consumer: consumer,
-		Streams:  []string{stream, ">"},
+		Streams:  args,
 		Block:    block,
 		Count:    1,
 	}).Result()
+}
+
+func (s *StreamsStore) AckJob(stream, group, id string) error {
+	ctx := context.Background()
+	return s.Client.XAck(ctx, stream, group, id).Err()
+}
+
+// TouchJob resets the idle time of a job the consumer is still working on, so that it
+// is not reclaimed by another agent.
+func (s *StreamsStore) TouchJob(stream, group, consumer, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.Client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		Messages: []string{id},
+	}).Err()
+}
+
+// ReclaimJobs takes over up to count entries of the group that have been pending for
+// longer than minIdle, whichever consumer they were delivered to.
+func (s *StreamsStore) ReclaimJobs(stream, group, consumer string, minIdle time.Duration, count int64) ([]PendingJob, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, _, err := s.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    group,
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
 	if err != nil {
 		return nil, err
 	}
 
-	if len(res) == 0 {
+	if len(messages) == 0 {
 		return nil, nil
 	}
 
-	return res[0].Messages, nil
+	pending, err := s.Client.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream:   stream,
+		Group:    group,
+		Start:    messages[0].ID,
+		End:      messages[len(messages)-1].ID,
+		Count:    int64(len(messages)),
+		Consumer: consumer,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make(map[string]int64, len(pending))
+	for _, p := range pending {
+		deliveries[p.ID] = p.RetryCount
+	}
+
+	jobs := make([]PendingJob, 0, len(messages))
+	for _, msg := range messages {
+		jobs = append(jobs, PendingJob{Stream: stream, Message: msg, Deliveries: deliveries[msg.ID]})
+	}
+	return jobs, nil
 }
 
-func (s *StreamsStore) AckJob(stream, group, id string) error {
-	ctx := context.Background()
-	return s.Client.XAck(ctx, stream, group, id).Err()
+// DeadLetterJob copies the job to the dead-letter stream of its stream and acknowledges it.
+func (s *StreamsStore) DeadLetterJob(group string, job PendingJob, reason string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	values := make(map[string]interface{}, len(job.Message.Values)+4)
+	for k, v := range job.Message.Values {
+		values[k] = v
+	}
+	values["original_id"] = job.Message.ID
+	values["deliveries"] = job.Deliveries
+	values["reason"] = reason
+	values["failed_at"] = time.Now().Format(time.RFC3339)
+
+	pipe := s.Client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: DeadLetterStream(job.Stream), Values: values})
+	pipe.XAck(ctx, job.Stream, group, job.Message.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ListDeadLetters returns the latest count entries of the dead-letter stream of stream.
+func (s *StreamsStore) ListDeadLetters(stream string, count int64) ([]redis.XMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.Client.XRevRangeN(ctx, DeadLetterStream(stream), "+", "-", count).Result()
+}
+
+func (s *StreamsStore) GetDeadLetter(stream, id string) (*redis.XMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	messages, err := s.Client.XRange(ctx, DeadLetterStream(stream), id, id).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrNotFound
+	}
+	return &messages[0], nil
+}
+
+// RequeueDeadLetter publishes the job of a dead-letter entry on stream again and drops
+// the entry. It returns the id of the new job entry.
+func (s *StreamsStore) RequeueDeadLetter(stream, id string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	dead := DeadLetterStream(stream)
+	messages, err := s.Client.XRange(ctx, dead, id, id).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(messages) == 0 {
+		return "", ErrNotFound
+	}
+
+	payload, ok := messages[0].Values["payload"]
+	if !ok {
+		return "", fmt.Errorf("dead letter %s has no payload", id)
+	}
+
+	newID, err := s.Client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{
+			"payload":    payload,
+			"created_at": time.Now().Format(time.RFC3339),
+		},
+	}).Result()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.Client.XDel(ctx, dead, id).Err(); err != nil {
+		return newID, err
+	}
+	return newID, nil
+}
+
+func (s *StreamsStore) Publish(channel string, payload string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.Client.Publish(ctx, channel, payload).Err()
+}
+
+func (s *StreamsStore) Subscribe(ctx context.Context, channel string) (<-chan *redis.Message, func() error, error) {
+	pubsub := s.Client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, nil, err
+	}
+
+	return pubsub.Channel(), pubsub.Close, nil
 }
 
 func (s *StreamsStore) Ping() error {
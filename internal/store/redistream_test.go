@@ -0,0 +1,74 @@
+package store
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseJobStreams(t *testing.T) {
+	tests := []struct {
+		name          string
+		defaultStream string
+		applications  string
+		want          JobStreams
+		wantErr       bool
+	}{
+		{
+			name: "defaults",
+			want: JobStreams{Default: DefaultJobStream, Applications: map[string]string{}},
+		},
+		{
+			name:          "custom default",
+			defaultStream: "jobs",
+			want:          JobStreams{Default: "jobs", Applications: map[string]string{}},
+		},
+		{
+			name:         "application streams",
+			applications: " shop=shop_jobs, blog=blog_jobs ,",
+			want: JobStreams{Default: DefaultJobStream, Applications: map[string]string{
+				"shop": "shop_jobs",
+				"blog": "blog_jobs",
+			}},
+		},
+		{name: "missing stream", applications: "shop=", wantErr: true},
+		{name: "missing application", applications: "=shop_jobs", wantErr: true},
+		{name: "missing separator", applications: "shop", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseJobStreams(tt.defaultStream, tt.applications)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseJobStreams() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJobStreams() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobStreamsRouting(t *testing.T) {
+	streams, err := ParseJobStreams("jobs", "shop=shop_jobs,blog=shop_jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		application string
+		want        string
+	}{
+		{application: "shop", want: "shop_jobs"},
+		{application: "blog", want: "shop_jobs"},
+		{application: "other", want: "jobs"},
+	}
+	for _, tt := range tests {
+		if got := streams.For(tt.application); got != tt.want {
+			t.Errorf("For(%q) = %q, want %q", tt.application, got, tt.want)
+		}
+	}
+
+	if got, want := streams.All(), []string{"jobs", "shop_jobs"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v, want %v", got, want)
+	}
+}
@@ -1,30 +1,124 @@
 package traefik
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
 type (
 	Client struct {
-		dynamicFilePath string
+		// dynamicDir holds one dynamic file per service, watched by the file provider.
+		dynamicDir string
+		// certsDir holds the uploaded certificates, at a path Traefik reads as well.
+		certsDir string
+		// mu serializes the read-modify-write cycles on the dynamic files, which
+		// jobs of different services run concurrently.
+		mu sync.Mutex
+		// History is the number of previous versions of a dynamic file kept as
+		// backups. Zero keeps none.
+		History int
 	}
 
 	Config struct {
-		HTTP HTTP `yaml:"http"`
+		HTTP HTTP       `yaml:"http"`
+		TLS  *TLSConfig `yaml:"tls,omitempty"`
 	}
 
 	HTTP struct {
-		Routers  map[string]Router       `yaml:"routers"`
-		Services map[string]ServiceBlock `yaml:"services"`
+		Routers     map[string]Router       `yaml:"routers"`
+		Middlewares map[string]Middleware   `yaml:"middlewares,omitempty"`
+		Services    map[string]ServiceBlock `yaml:"services"`
 	}
 
 	Router struct {
-		Rule    string `yaml:"rule"`
-		Service string `yaml:"service"`
+		EntryPoints []string   `yaml:"entryPoints,omitempty"`
+		Rule        string     `yaml:"rule"`
+		Service     string     `yaml:"service"`
+		Middlewares []string   `yaml:"middlewares,omitempty"`
+		Priority    int        `yaml:"priority,omitempty"`
+		TLS         *RouterTLS `yaml:"tls,omitempty"`
+	}
+
+	RouterTLS struct {
+		CertResolver string `yaml:"certResolver,omitempty"`
+	}
+
+	Middleware struct {
+		RedirectScheme *RedirectScheme `yaml:"redirectScheme,omitempty"`
+		RateLimit      *RateLimit      `yaml:"rateLimit,omitempty"`
+		Headers        *Headers        `yaml:"headers,omitempty"`
+		BasicAuth      *BasicAuth      `yaml:"basicAuth,omitempty"`
+		Retry          *Retry          `yaml:"retry,omitempty"`
+		Compress       *Compress       `yaml:"compress,omitempty"`
+		StripPrefix    *StripPrefix    `yaml:"stripPrefix,omitempty"`
+		IPAllowList    *IPAllowList    `yaml:"ipAllowList,omitempty"`
+		CircuitBreaker *CircuitBreaker `yaml:"circuitBreaker,omitempty"`
+	}
+
+	RedirectScheme struct {
+		Scheme    string `yaml:"scheme"`
+		Permanent bool   `yaml:"permanent,omitempty"`
+	}
+
+	RateLimit struct {
+		Average int    `yaml:"average"`
+		Burst   int    `yaml:"burst,omitempty"`
+		Period  string `yaml:"period,omitempty"`
+	}
+
+	Headers struct {
+		CustomRequestHeaders          map[string]string `yaml:"customRequestHeaders,omitempty"`
+		CustomResponseHeaders         map[string]string `yaml:"customResponseHeaders,omitempty"`
+		AccessControlAllowOriginList  []string          `yaml:"accessControlAllowOriginList,omitempty"`
+		AccessControlAllowMethods     []string          `yaml:"accessControlAllowMethods,omitempty"`
+		AccessControlAllowHeaders     []string          `yaml:"accessControlAllowHeaders,omitempty"`
+		AccessControlAllowCredentials bool              `yaml:"accessControlAllowCredentials,omitempty"`
+		AccessControlMaxAge           int               `yaml:"accessControlMaxAge,omitempty"`
+		STSSeconds                    int               `yaml:"stsSeconds,omitempty"`
+		FrameDeny                     bool              `yaml:"frameDeny,omitempty"`
+		ContentTypeNosniff            bool              `yaml:"contentTypeNosniff,omitempty"`
+		BrowserXSSFilter              bool              `yaml:"browserXssFilter,omitempty"`
+		ReferrerPolicy                string            `yaml:"referrerPolicy,omitempty"`
+	}
+
+	BasicAuth struct {
+		Users []string `yaml:"users"`
+		Realm string   `yaml:"realm,omitempty"`
+	}
+
+	Retry struct {
+		Attempts        int    `yaml:"attempts"`
+		InitialInterval string `yaml:"initialInterval,omitempty"`
+	}
+
+	Compress struct{}
+
+	StripPrefix struct {
+		Prefixes []string `yaml:"prefixes"`
+	}
+
+	IPAllowList struct {
+		SourceRange []string `yaml:"sourceRange"`
+	}
+
+	CircuitBreaker struct {
+		Expression string `yaml:"expression"`
+	}
+
+	TLSConfig struct {
+		Certificates []CertificateFiles `yaml:"certificates,omitempty"`
+	}
+
+	CertificateFiles struct {
+		CertFile string `yaml:"certFile"`
+		KeyFile  string `yaml:"keyFile"`
 	}
 
 	ServiceBlock struct {
@@ -54,33 +148,99 @@ type (
 		Weight int
 	}
 
+	// RouterRule is a route of a service: the rule matching its requests and its
+	// priority over overlapping routes.
+	RouterRule struct {
+		Rule     string
+		Priority int
+	}
+
+	// ServiceRoutes is everything the routers of a service are made of.
+	ServiceRoutes struct {
+		Rules       []RouterRule
+		TLS         RouterTLSOptions
+		Middlewares []RouterMiddleware
+	}
+
+	// RouterMiddleware is a middleware attached to every router of a service, named
+	// <service>-<Name> in the dynamic file.
+	RouterMiddleware struct {
+		Name       string
+		Middleware Middleware
+	}
+
+	// RouterTLSOptions serves the routes of a service over HTTPS on the websecure
+	// entrypoint, redirecting their plain HTTP requests when RedirectHTTP is set.
+	RouterTLSOptions struct {
+		Enabled      bool
+		CertResolver string
+		RedirectHTTP bool
+	}
+
 	TraefikInterface interface {
-		EnsureRouter(serviceName, rule string) error
-		InsertWeightedService(serviceName string, backends []WeightedBackend) error
-		GetCurrentSlot(serviceName string) (string, error)
-		GetCandidateSlot(serviceName string) (string, error)
-		GetNoWeightSlot(serviceName string) (string, error)
-		PointRouterTo(serviceName, slot string) error
+		EnsureRouter(application, serviceName string, routes ServiceRoutes) error
+		SetCertificate(application, serviceName, cert, key string) error
+		RemoveCertificate(application, serviceName string) error
+		InsertWeightedService(application, serviceName string, backends []WeightedBackend) error
+		GetCurrentSlot(application, serviceName string) (string, error)
+		GetCandidateSlot(application, serviceName string) (string, error)
+		GetNoWeightSlot(application, serviceName string) (string, error)
+		PointRouterTo(application, serviceName, slot string) error
+		GetSlots(application, serviceName string) ([]string, error)
+		GetWeights(application, serviceName string) (map[string]int, error)
+		RemoveService(application, serviceName string) error
 	}
 )
 
-func NewClient(dynamicFilePath string) *Client {
-	return &Client{dynamicFilePath: dynamicFilePath}
+const (
+	EntryPointWeb       = "web"
+	EntryPointWebSecure = "websecure"
+)
+
+// NewClient manages the dynamic files of Traefik in dynamicDir, one per service named
+// <application>-<service>.yml. Uploaded certificates are written to certsDir, or to a
+// certs directory next to dynamicDir when it is empty.
+func NewClient(dynamicDir, certsDir string) *Client {
+	if certsDir == "" {
+		certsDir = filepath.Join(filepath.Dir(filepath.Clean(dynamicDir)), "certs")
+	}
+	return &Client{dynamicDir: dynamicDir, certsDir: certsDir, History: DefaultHistory}
+}
+
+// serviceKey names the dynamic file and the certificates directory of a service. The
+// names come from API requests, so they are escaped for a slash or a leading dot not to
+// take the file out of its directory.
+func serviceKey(application, serviceName string) string {
+	return fmt.Sprintf("%s-%s", escapeName(application), escapeName(serviceName))
 }
 
-func (c *Client) load() (*Config, error) {
-	file, err := os.ReadFile(c.dynamicFilePath)
-	if err != nil {
-		return nil, err
+// escapeName keeps letters, digits and dashes and writes any other byte as _<hex>.
+func escapeName(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "_%02x", ch)
+		}
 	}
+	return b.String()
+}
 
-	cfg := &Config{}
-	if len(file) == 0 {
-		cfg.HTTP.Routers = map[string]Router{}
-		cfg.HTTP.Services = map[string]ServiceBlock{}
-		return cfg, nil
+func (c *Client) serviceFile(application, serviceName string) string {
+	return filepath.Join(c.dynamicDir, serviceKey(application, serviceName)+".yml")
+}
+
+// load reads a dynamic file, a missing one being an empty config.
+func (c *Client) load(path string) (*Config, error) {
+	file, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
 	}
 
+	cfg := &Config{}
 	if err := yaml.Unmarshal(file, cfg); err != nil {
 		return nil, err
 	}
@@ -91,38 +251,187 @@ func (c *Client) load() (*Config, error) {
 	if cfg.HTTP.Services == nil {
 		cfg.HTTP.Services = map[string]ServiceBlock{}
 	}
+	if cfg.HTTP.Middlewares == nil {
+		cfg.HTTP.Middlewares = map[string]Middleware{}
+	}
 
 	return cfg, nil
 }
 
-func (c *Client) save(cfg *Config) error {
-	out, err := yaml.Marshal(cfg)
+// EnsureRouter replaces the routers and middlewares of serviceName with one router per
+// rule, all of them sending to the weighted service through the middlewares of the
+// service. The first
+// router is named after the service and the others get a -route-<n> suffix. With TLS
+// the routers only answer on the websecure entrypoint, and a -redirect router per rule
+// sends the web entrypoint to HTTPS.
+func (c *Client) EnsureRouter(application, serviceName string, routes ServiceRoutes) error {
+	if len(routes.Rules) == 0 {
+		return fmt.Errorf("no route for %s", serviceName)
+	}
+
+	unlock, err := c.lock()
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(c.dynamicFilePath, out, 0644)
-}
+	defer unlock()
 
-func (c *Client) EnsureRouter(serviceName, rule string) error {
-	cfg, err := c.load()
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
 	if err != nil {
 		return err
 	}
 
 	splitName := fmt.Sprintf("%s-svc", serviceName)
+	redirectName := fmt.Sprintf("%s-https-redirect", serviceName)
+	cfg.HTTP.Routers = map[string]Router{}
+	cfg.HTTP.Middlewares = map[string]Middleware{}
+
+	var middlewares []string
+	for _, m := range routes.Middlewares {
+		name := fmt.Sprintf("%s-%s", serviceName, m.Name)
+		cfg.HTTP.Middlewares[name] = m.Middleware
+		middlewares = append(middlewares, name)
+	}
+
+	tls := routes.TLS
+	for i, rule := range routes.Rules {
+		name := serviceName
+		if i > 0 {
+			name = fmt.Sprintf("%s-route-%d", serviceName, i)
+		}
+
+		router := Router{
+			Rule:        rule.Rule,
+			Service:     splitName,
+			Middlewares: middlewares,
+			Priority:    rule.Priority,
+		}
+
+		if tls.Enabled {
+			router.EntryPoints = []string{EntryPointWebSecure}
+			router.TLS = &RouterTLS{CertResolver: tls.CertResolver}
+
+			if tls.RedirectHTTP {
+				cfg.HTTP.Routers[name+"-redirect"] = Router{
+					EntryPoints: []string{EntryPointWeb},
+					Rule:        rule.Rule,
+					Service:     splitName,
+					Middlewares: []string{redirectName},
+					Priority:    rule.Priority,
+				}
+			}
+		}
+
+		cfg.HTTP.Routers[name] = router
+	}
 
-	if _, ok := cfg.HTTP.Routers[serviceName]; !ok {
-		cfg.HTTP.Routers[serviceName] = Router{
-			Rule:    rule,
-			Service: splitName,
+	if tls.Enabled && tls.RedirectHTTP {
+		cfg.HTTP.Middlewares[redirectName] = Middleware{
+			RedirectScheme: &RedirectScheme{Scheme: "https", Permanent: true},
 		}
 	}
 
-	return c.save(cfg)
+	return c.save(path, cfg)
+}
+
+// SetCertificate writes the certificate of serviceName to the certs directory and
+// replaces the one it had in its dynamic file. The files are named after their content
+// so that Traefik sees the dynamic file change and reloads them.
+func (c *Client) SetCertificate(application, serviceName, cert, key string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	dir := filepath.Join(c.certsDir, serviceKey(application, serviceName))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256([]byte(cert + key))
+	name := hex.EncodeToString(sum[:8])
+	files := CertificateFiles{
+		CertFile: filepath.Join(dir, name+".crt"),
+		KeyFile:  filepath.Join(dir, name+".key"),
+	}
+
+	if err := os.WriteFile(files.CertFile, []byte(cert), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(files.KeyFile, []byte(key), 0600); err != nil {
+		return err
+	}
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
+	if err != nil {
+		return err
+	}
+
+	previous := cfg.TLS
+	cfg.TLS = &TLSConfig{Certificates: []CertificateFiles{files}}
+
+	if err := c.save(path, cfg); err != nil {
+		return err
+	}
+
+	// Only the files of the certificate now in use are kept.
+	removeCertificateFiles(previous, files)
+	return nil
 }
 
-func (c *Client) InsertWeightedService(serviceName string, backends []WeightedBackend) error {
-	cfg, err := c.load()
+// RemoveCertificate drops the certificate of serviceName from its dynamic file and
+// deletes its files.
+func (c *Client) RemoveCertificate(application, serviceName string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
+	if err != nil {
+		return err
+	}
+
+	if previous := cfg.TLS; previous != nil {
+		cfg.TLS = nil
+		if err := c.save(path, cfg); err != nil {
+			return err
+		}
+		removeCertificateFiles(previous, CertificateFiles{})
+	}
+
+	return os.RemoveAll(filepath.Join(c.certsDir, serviceKey(application, serviceName)))
+}
+
+// removeCertificateFiles deletes the files of the certificates in tls except keep, and
+// their directory once it is empty.
+func removeCertificateFiles(tls *TLSConfig, keep CertificateFiles) {
+	if tls == nil {
+		return
+	}
+
+	for _, files := range tls.Certificates {
+		if files != keep {
+			_ = os.Remove(files.CertFile)
+			_ = os.Remove(files.KeyFile)
+			_ = os.Remove(filepath.Dir(files.CertFile))
+		}
+	}
+}
+
+func (c *Client) InsertWeightedService(application, serviceName string, backends []WeightedBackend) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
 	if err != nil {
 		return err
 	}
@@ -148,78 +457,58 @@ func (c *Client) InsertWeightedService(serviceName string, backends []WeightedBa
 		Weighted: weighted,
 	}
 
-	return c.save(cfg)
+	return c.save(path, cfg)
 }
 
-func (c *Client) GetCurrentSlot(serviceName string) (string, error) {
-	cfg, err := c.load()
-	if err != nil {
-		return "", err
-	}
+// GetCurrentSlot returns the slot of serviceName receiving the most traffic.
+func (c *Client) GetCurrentSlot(application, serviceName string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	r, ok := cfg.HTTP.Routers[serviceName]
-	if !ok {
-		return "", fmt.Errorf("router %s not found", serviceName)
-	}
+	current, _, err := c.slots(application, serviceName)
+	return current, err
+}
 
-	if !strings.HasSuffix(r.Service, "-svc") {
-		if strings.HasSuffix(r.Service, "-v1") {
-			return "v1", nil
-		}
-		if strings.HasSuffix(r.Service, "-v2") {
-			return "v2", nil
-		}
-		return "v1", nil
-	}
+// GetCandidateSlot returns the slot of serviceName next to the one receiving the most traffic.
+func (c *Client) GetCandidateSlot(application, serviceName string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	split, ok := cfg.HTTP.Services[r.Service]
-	if !ok || split.Weighted == nil || len(split.Weighted.Services) == 0 {
-		return "", fmt.Errorf("no split config for %s", serviceName)
+	current, backends, err := c.slots(application, serviceName)
+	if err != nil {
+		return "", err
 	}
 
-	var maxWeight WeightedService
-	for _, s := range split.Weighted.Services {
-		if s.Weight > maxWeight.Weight {
-			maxWeight = s
+	for _, b := range backends {
+		if slot := slotOf(serviceName, b.Name); slot != current {
+			return slot, nil
 		}
 	}
 
-	name := strings.Split(maxWeight.Name, "@")[0]
-
-	if strings.HasSuffix(name, "-v1") {
-		return "v1", nil
-	}
-	if strings.HasSuffix(name, "-v2") {
-		return "v2", nil
-	}
-
-	return "", fmt.Errorf("unknown slot")
+	return "", fmt.Errorf("no candidate slot for %s", serviceName)
 }
 
-func (c *Client) GetCandidateSlot(serviceName string) (string, error) {
-	cfg, err := c.load()
+// slots returns the slot of serviceName receiving the most traffic and the backends of
+// its weighted service. A router sending to a slot directly has no other backend.
+func (c *Client) slots(application, serviceName string) (string, []WeightedService, error) {
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 
 	r, ok := cfg.HTTP.Routers[serviceName]
 	if !ok {
-		return "", fmt.Errorf("router %s not found", serviceName)
+		return "", nil, fmt.Errorf("router %s not found", serviceName)
 	}
 
 	if !strings.HasSuffix(r.Service, "-svc") {
-		if strings.HasSuffix(r.Service, "-v1") {
-			return "v2", nil
-		}
-		if strings.HasSuffix(r.Service, "-v2") {
-			return "v1", nil
-		}
-		return "v1", nil
+		return slotOf(serviceName, r.Service), nil, nil
 	}
 
 	split, ok := cfg.HTTP.Services[r.Service]
 	if !ok || split.Weighted == nil || len(split.Weighted.Services) == 0 {
-		return "", fmt.Errorf("no split config for %s", serviceName)
+		return "", nil, fmt.Errorf("no split config for %s", serviceName)
 	}
 
 	var maxWeight WeightedService
@@ -229,20 +518,25 @@ func (c *Client) GetCandidateSlot(serviceName string) (string, error) {
 		}
 	}
 
-	name := strings.Split(maxWeight.Name, "@")[0]
-
-	if strings.HasSuffix(name, "-v1") {
-		return "v2", nil
-	}
-	if strings.HasSuffix(name, "-v2") {
-		return "v1", nil
+	if maxWeight.Name == "" {
+		return "", nil, fmt.Errorf("no slot of %s receives traffic", serviceName)
 	}
 
-	return "", fmt.Errorf("unknown slot")
+	return slotOf(serviceName, maxWeight.Name), split.Weighted.Services, nil
+}
+
+// slotOf returns the slot of a backend named <service>-<slot>@<provider>.
+func slotOf(serviceName, backend string) string {
+	fullName := strings.SplitN(backend, "@", 2)[0]
+	return strings.TrimPrefix(fullName, serviceName+"-")
 }
 
-func (c *Client) GetNoWeightSlot(serviceName string) (string, error) {
-	cfg, err := c.load()
+func (c *Client) GetNoWeightSlot(application, serviceName string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
 	if err != nil {
 		return "", err
 	}
@@ -260,22 +554,26 @@ func (c *Client) GetNoWeightSlot(serviceName string) (string, error) {
 	for _, s := range svc.Weighted.Services {
 		if s.Weight == 0 {
 			fullName := strings.SplitN(s.Name, "@", 2)[0]
-
-			appPrefix := strings.TrimSuffix(r.Service, "-svc") + "-"
-			if !strings.HasPrefix(fullName, appPrefix) {
+			if !strings.HasPrefix(fullName, serviceName+"-") {
 				return "", fmt.Errorf("unexpected service name format: %s", fullName)
 			}
 
-			slot := strings.TrimPrefix(fullName, appPrefix)
-			return slot, nil
+			return slotOf(serviceName, s.Name), nil
 		}
 	}
 
 	return "", fmt.Errorf("no slot with weight zero found for %s", serviceName)
 }
 
-func (c *Client) PointRouterTo(serviceName, slot string) error {
-	cfg, err := c.load()
+func (c *Client) PointRouterTo(application, serviceName, slot string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
 	if err != nil {
 		return err
 	}
@@ -288,5 +586,83 @@ func (c *Client) PointRouterTo(serviceName, slot string) error {
 	r.Service = fmt.Sprintf("%s-svc", serviceName)
 	cfg.HTTP.Routers[serviceName] = r
 
-	return c.save(cfg)
+	return c.save(path, cfg)
+}
+
+// GetSlots lists every slot referenced by the weighted service of serviceName.
+func (c *Client) GetSlots(application, serviceName string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	svc, ok := cfg.HTTP.Services[fmt.Sprintf("%s-svc", serviceName)]
+	if !ok || svc.Weighted == nil {
+		return nil, nil
+	}
+
+	var slots []string
+	for _, s := range svc.Weighted.Services {
+		slots = append(slots, slotOf(serviceName, s.Name))
+	}
+
+	return slots, nil
+}
+
+// GetWeights returns the weight of every slot referenced by the weighted service of serviceName.
+func (c *Client) GetWeights(application, serviceName string) (map[string]int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	weights := map[string]int{}
+	svc, ok := cfg.HTTP.Services[fmt.Sprintf("%s-svc", serviceName)]
+	if !ok || svc.Weighted == nil {
+		return weights, nil
+	}
+
+	for _, s := range svc.Weighted.Services {
+		weights[slotOf(serviceName, s.Name)] = s.Weight
+	}
+
+	return weights, nil
+}
+
+// RemoveService deletes the dynamic file of serviceName, its backups and its certificate.
+func (c *Client) RemoveService(application, serviceName string) error {
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	path := c.serviceFile(application, serviceName)
+	cfg, err := c.load(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	backups, err := c.backups(path)
+	if err != nil {
+		return err
+	}
+	for _, backup := range backups {
+		_ = os.Remove(backup)
+	}
+
+	removeCertificateFiles(cfg.TLS, CertificateFiles{})
+	return os.RemoveAll(filepath.Join(c.certsDir, serviceKey(application, serviceName)))
 }
@@ -0,0 +1,106 @@
+package traefik
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServiceKey(t *testing.T) {
+	tests := []struct {
+		application string
+		serviceName string
+		want        string
+	}{
+		{application: "shop", serviceName: "api", want: "shop-api"},
+		{application: "shop-api", serviceName: "web", want: "shop-api-web"},
+		{application: "shop.eu", serviceName: "api", want: "shop_2eeu-api"},
+		{application: "my_app", serviceName: "a/b", want: "my_5fapp-a_2fb"},
+	}
+
+	for _, tt := range tests {
+		if got := serviceKey(tt.application, tt.serviceName); got != tt.want {
+			t.Errorf("serviceKey(%q, %q) = %q, want %q", tt.application, tt.serviceName, got, tt.want)
+		}
+	}
+}
+
+func TestClientSlots(t *testing.T) {
+	tests := []struct {
+		name          string
+		backends      []WeightedBackend
+		wantCurrent   string
+		wantCandidate string
+		wantNoWeight  string
+	}{
+		{
+			name:          "blue receives traffic",
+			backends:      []WeightedBackend{{Name: "api-blue", Weight: 100}, {Name: "api-green", Weight: 0}},
+			wantCurrent:   "blue",
+			wantCandidate: "green",
+			wantNoWeight:  "green",
+		},
+		{
+			name:          "revisioned versions",
+			backends:      []WeightedBackend{{Name: "api-v1", Weight: 0}, {Name: "api-v1-r1", Weight: 100}},
+			wantCurrent:   "v1-r1",
+			wantCandidate: "v1",
+			wantNoWeight:  "v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(t.TempDir(), "")
+			if err := c.EnsureRouter("shop", "api", ServiceRoutes{Rules: []RouterRule{{Rule: "Host(`shop.test`)"}}}); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.InsertWeightedService("shop", "api", tt.backends); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := c.GetCurrentSlot("shop", "api"); err != nil || got != tt.wantCurrent {
+				t.Errorf("GetCurrentSlot() = %q, %v, want %q", got, err, tt.wantCurrent)
+			}
+			if got, err := c.GetCandidateSlot("shop", "api"); err != nil || got != tt.wantCandidate {
+				t.Errorf("GetCandidateSlot() = %q, %v, want %q", got, err, tt.wantCandidate)
+			}
+			if got, err := c.GetNoWeightSlot("shop", "api"); err != nil || got != tt.wantNoWeight {
+				t.Errorf("GetNoWeightSlot() = %q, %v, want %q", got, err, tt.wantNoWeight)
+			}
+		})
+	}
+}
+
+func TestClientKeepsOneFilePerService(t *testing.T) {
+	dir := t.TempDir()
+	c := NewClient(dir, "")
+
+	for _, application := range []string{"shop", "blog"} {
+		routes := ServiceRoutes{Rules: []RouterRule{{Rule: "Host(`" + application + ".test`)"}}}
+		if err := c.EnsureRouter(application, "api", routes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.InsertWeightedService("shop", "api", []WeightedBackend{{Name: "api-v1", Weight: 100}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := c.load(filepath.Join(dir, "shop-api.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if router, ok := cfg.HTTP.Routers["api"]; !ok || router.Service != "api-svc" {
+		t.Errorf("router api = %+v, %v, want service api-svc", router, ok)
+	}
+
+	if err := c.RemoveService("blog", "api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "blog-api.yml")); !os.IsNotExist(err) {
+		t.Errorf("blog-api.yml still exists: %v", err)
+	}
+	if got, err := c.GetCurrentSlot("shop", "api"); err != nil || got != "v1" {
+		t.Errorf("GetCurrentSlot() = %q, %v, want v1", got, err)
+	}
+}
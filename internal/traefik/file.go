@@ -0,0 +1,182 @@
+package traefik
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultHistory is the number of previous versions of a dynamic file kept next to it.
+const DefaultHistory = 10
+
+const backupSuffix = ".bak"
+
+// lock serializes the read-modify-write cycles on the dynamic files, within this process
+// and with every other process taking the advisory lock, such as the agents sharing
+// the directory. The returned func releases it.
+func (c *Client) lock() (func(), error) {
+	c.mu.Lock()
+
+	if err := os.MkdirAll(c.dynamicDir, 0755); err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(c.dynamicDir, ".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("open lock file: %w", err)
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		c.mu.Unlock()
+		return nil, fmt.Errorf("lock dynamic file: %w", err)
+	}
+
+	return func() {
+		_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+		c.mu.Unlock()
+	}, nil
+}
+
+// save checks cfg and replaces the dynamic file at path with it in one rename, so
+// Traefik never reads a half written file. The file being replaced is kept as a backup first.
+func (c *Client) save(path string, cfg *Config) error {
+	if err := validate(cfg); err != nil {
+		return fmt.Errorf("invalid dynamic config: %w", err)
+	}
+
+	out, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var check Config
+	if err := yaml.Unmarshal(out, &check); err != nil {
+		return fmt.Errorf("invalid dynamic config: %w", err)
+	}
+
+	if err := c.backup(path, out); err != nil {
+		return fmt.Errorf("backup dynamic file: %w", err)
+	}
+
+	dir, base := filepath.Split(path)
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(out); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// backup copies the dynamic file at path to <path>.<time>.bak unless next is the same,
+// and drops its oldest backups beyond History. A backup is restored by copying it over
+// the dynamic file.
+func (c *Client) backup(path string, next []byte) error {
+	if c.History <= 0 {
+		return nil
+	}
+
+	current, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if len(current) == 0 || bytes.Equal(current, next) {
+		return nil
+	}
+
+	name := fmt.Sprintf("%s.%s%s", path, time.Now().UTC().Format("20060102T150405.000000000"), backupSuffix)
+	if err := os.WriteFile(name, current, 0644); err != nil {
+		return err
+	}
+
+	backups, err := c.backups(path)
+	if err != nil {
+		return err
+	}
+	for len(backups) > c.History {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// backups lists the kept versions of the dynamic file at path, oldest first.
+func (c *Client) backups(path string) ([]string, error) {
+	backups, err := filepath.Glob(path + ".*" + backupSuffix)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// validate checks that every router of cfg has a rule and a service and only uses
+// middlewares that are defined, here or by another provider. The weighted service a
+// router sends to may not exist yet, as it is written once the first slot is healthy.
+func validate(cfg *Config) error {
+	for name, router := range cfg.HTTP.Routers {
+		if strings.TrimSpace(router.Rule) == "" {
+			return fmt.Errorf("router %s has no rule", name)
+		}
+
+		if router.Service == "" {
+			return fmt.Errorf("router %s has no service", name)
+		}
+
+		for _, middleware := range router.Middlewares {
+			if _, ok := cfg.HTTP.Middlewares[middleware]; !ok && !fromProvider(middleware) {
+				return fmt.Errorf("router %s uses unknown middleware %s", name, middleware)
+			}
+		}
+	}
+
+	for name, service := range cfg.HTTP.Services {
+		if service.Weighted == nil && service.LoadBalancer == nil {
+			return fmt.Errorf("service %s has no backend", name)
+		}
+	}
+
+	if cfg.TLS != nil {
+		for _, files := range cfg.TLS.Certificates {
+			if files.CertFile == "" || files.KeyFile == "" {
+				return fmt.Errorf("certificate without cert or key file")
+			}
+		}
+	}
+
+	return nil
+}
+
+func fromProvider(name string) bool {
+	return strings.Contains(name, "@")
+}
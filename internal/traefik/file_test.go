@@ -0,0 +1,114 @@
+package traefik
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientSave(t *testing.T) {
+	valid := func() *Config {
+		cfg := &Config{}
+		cfg.HTTP.Routers = map[string]Router{"shop.api": {Rule: "Host(`shop.test`)", Service: "shop.api-svc"}}
+		return cfg
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(cfg *Config)
+		wantErr bool
+	}{
+		{name: "valid", edit: func(cfg *Config) {}},
+		{
+			name: "middleware of another provider",
+			edit: func(cfg *Config) {
+				r := cfg.HTTP.Routers["shop.api"]
+				r.Middlewares = []string{"auth@docker"}
+				cfg.HTTP.Routers["shop.api"] = r
+			},
+		},
+		{
+			name: "router without rule",
+			edit: func(cfg *Config) {
+				cfg.HTTP.Routers["shop.api"] = Router{Service: "shop.api-svc"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "router without service",
+			edit: func(cfg *Config) {
+				cfg.HTTP.Routers["shop.api"] = Router{Rule: "Host(`shop.test`)"}
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown middleware",
+			edit: func(cfg *Config) {
+				r := cfg.HTTP.Routers["shop.api"]
+				r.Middlewares = []string{"shop.api-auth"}
+				cfg.HTTP.Routers["shop.api"] = r
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(t.TempDir(), "")
+			path := filepath.Join(c.dynamicDir, "shop.api.yml")
+			if err := os.WriteFile(path, []byte("previous"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := valid()
+			tt.edit(cfg)
+			err := c.save(path, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("save() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			content, _ := os.ReadFile(path)
+			if tt.wantErr && string(content) != "previous" {
+				t.Errorf("rejected config replaced the file: %q", content)
+			}
+			if !tt.wantErr && string(content) == "previous" {
+				t.Error("valid config was not written")
+			}
+
+			leftovers, _ := filepath.Glob(filepath.Join(c.dynamicDir, ".*.tmp-*"))
+			if len(leftovers) > 0 {
+				t.Errorf("temporary files left: %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestClientSaveKeepsHistory(t *testing.T) {
+	c := NewClient(t.TempDir(), "")
+	c.History = 2
+	path := filepath.Join(c.dynamicDir, "shop.api.yml")
+
+	for i := 0; i < 5; i++ {
+		cfg := &Config{}
+		cfg.HTTP.Routers = map[string]Router{"shop.api": {Rule: "Host(`shop.test`)", Service: "shop.api-svc", Priority: i}}
+		if err := c.save(path, cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backups, err := c.backups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("kept %d backups, want 2: %v", len(backups), backups)
+	}
+
+	latest, err := c.load(backups[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := latest.HTTP.Routers["shop.api"].Priority; got != 3 {
+		t.Errorf("latest backup has priority %d, want 3", got)
+	}
+}
@@ -0,0 +1,67 @@
+package traefik
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/elissonalvesilva/releasy/pkg/httpclient"
+)
+
+type (
+	metricsClient struct {
+		url    string
+		client *httpclient.Client
+	}
+
+	// MetricsReader reads the request counters Traefik exposes for a service.
+	MetricsReader interface {
+		ServiceRequests(serviceName string) (total float64, failed float64, err error)
+	}
+)
+
+const requestsTotalMetric = "traefik_service_requests_total{"
+
+func NewMetricsClient(url string, client *httpclient.Client) *metricsClient {
+	return &metricsClient{url: url, client: client}
+}
+
+// ServiceRequests sums every request served by the given docker service, and the ones
+// answered with a 5xx status, from the Traefik prometheus endpoint.
+func (m *metricsClient) ServiceRequests(serviceName string) (float64, float64, error) {
+	resp, err := m.client.Get(m.url)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, fmt.Errorf("metrics returned status %d", resp.StatusCode)
+	}
+
+	serviceLabel := fmt.Sprintf(`service="%s@docker"`, serviceName)
+
+	var total, failed float64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, requestsTotalMetric) || !strings.Contains(line, serviceLabel) {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		value, err := strconv.ParseFloat(fields[len(fields)-1], 64)
+		if err != nil {
+			continue
+		}
+
+		total += value
+		if strings.Contains(line, `code="5`) {
+			failed += value
+		}
+	}
+
+	return total, failed, scanner.Err()
+}
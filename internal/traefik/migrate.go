@@ -0,0 +1,182 @@
+package traefik
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ServiceRef names a service of an application.
+type ServiceRef struct {
+	Application string
+	Name        string
+}
+
+// MigrateLegacyFile moves the routers, middlewares, weighted service and certificate of
+// every service found in the shared dynamic file at path to the dynamic file of the
+// service, and moves its certificate files to its certificates directory. A service name used by several applications is left in the
+// shared file, as nothing there tells which one it routes to, and is returned so that
+// it can be moved by hand. Whatever belongs to no known service stays in the shared
+// file too, which is deleted once it is empty.
+func (c *Client) MigrateLegacyFile(path string, services []ServiceRef) ([]string, error) {
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	legacy, err := c.load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	applications := map[string][]string{}
+	for _, s := range services {
+		applications[s.Name] = append(applications[s.Name], s.Application)
+	}
+
+	var ambiguous []string
+	var moved []*TLSConfig
+	for _, s := range services {
+		if len(applications[s.Name]) > 1 {
+			if _, ok := legacy.HTTP.Routers[s.Name]; ok && !slices.Contains(ambiguous, s.Name) {
+				ambiguous = append(ambiguous, s.Name)
+			}
+			continue
+		}
+
+		cfg, ok := extractService(legacy, s.Name, filepath.Join(c.certsDir, s.Name))
+		if !ok {
+			continue
+		}
+
+		previous, err := moveCertificates(cfg, filepath.Join(c.certsDir, serviceKey(s.Application, s.Name)))
+		if err != nil {
+			return nil, fmt.Errorf("migrate %s: %w", s.Name, err)
+		}
+
+		if err := c.save(c.serviceFile(s.Application, s.Name), cfg); err != nil {
+			return nil, fmt.Errorf("migrate %s: %w", s.Name, err)
+		}
+		moved = append(moved, previous)
+	}
+
+	if len(legacy.HTTP.Routers) > 0 || len(legacy.HTTP.Services) > 0 || len(legacy.HTTP.Middlewares) > 0 || legacy.TLS != nil {
+		if err := c.save(path, legacy); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := c.backup(path, nil); err != nil {
+			return nil, fmt.Errorf("backup dynamic file: %w", err)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The shared file no longer points at the old certificate files.
+	for _, tls := range moved {
+		removeCertificateFiles(tls, CertificateFiles{})
+	}
+
+	return ambiguous, nil
+}
+
+// extractService removes from cfg the router named after serviceName, every router
+// sending to its weighted service, the middlewares of the service they use, the
+// weighted service and the certificates stored in certsDir. It returns them as a config
+// of their own and reports whether there was any.
+func extractService(cfg *Config, serviceName, certsDir string) (*Config, bool) {
+	moved := &Config{}
+	moved.HTTP.Routers = map[string]Router{}
+	moved.HTTP.Middlewares = map[string]Middleware{}
+	moved.HTTP.Services = map[string]ServiceBlock{}
+
+	splitName := fmt.Sprintf("%s-svc", serviceName)
+	for name, router := range cfg.HTTP.Routers {
+		if name != serviceName && router.Service != splitName {
+			continue
+		}
+
+		for _, middleware := range router.Middlewares {
+			if m, ok := cfg.HTTP.Middlewares[middleware]; ok && strings.HasPrefix(middleware, serviceName+"-") {
+				moved.HTTP.Middlewares[middleware] = m
+				delete(cfg.HTTP.Middlewares, middleware)
+			}
+		}
+		moved.HTTP.Routers[name] = router
+		delete(cfg.HTTP.Routers, name)
+	}
+
+	if split, ok := cfg.HTTP.Services[splitName]; ok {
+		moved.HTTP.Services[splitName] = split
+		delete(cfg.HTTP.Services, splitName)
+	}
+
+	if cfg.TLS != nil {
+		kept := cfg.TLS.Certificates[:0]
+		for _, files := range cfg.TLS.Certificates {
+			if filepath.Dir(files.CertFile) != certsDir {
+				kept = append(kept, files)
+				continue
+			}
+
+			if moved.TLS == nil {
+				moved.TLS = &TLSConfig{}
+			}
+			moved.TLS.Certificates = append(moved.TLS.Certificates, files)
+		}
+
+		cfg.TLS.Certificates = kept
+		if len(kept) == 0 {
+			cfg.TLS = nil
+		}
+	}
+
+	found := len(moved.HTTP.Routers) > 0 || len(moved.HTTP.Services) > 0 || moved.TLS != nil
+	return moved, found
+}
+
+// moveCertificates copies the certificate files of cfg to dir and points cfg at the
+// copies. It returns the certificates as they were, for their files to be deleted once
+// nothing refers to them.
+func moveCertificates(cfg *Config, dir string) (*TLSConfig, error) {
+	if cfg.TLS == nil {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	previous := &TLSConfig{Certificates: append([]CertificateFiles(nil), cfg.TLS.Certificates...)}
+	for i, files := range cfg.TLS.Certificates {
+		certFile := filepath.Join(dir, filepath.Base(files.CertFile))
+		if err := copyFile(files.CertFile, certFile, 0644); err != nil {
+			return nil, err
+		}
+
+		keyFile := filepath.Join(dir, filepath.Base(files.KeyFile))
+		if err := copyFile(files.KeyFile, keyFile, 0600); err != nil {
+			return nil, err
+		}
+
+		cfg.TLS.Certificates[i] = CertificateFiles{CertFile: certFile, KeyFile: keyFile}
+	}
+
+	return previous, nil
+}
+
+func copyFile(from, to string, perm os.FileMode) error {
+	content, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(to, content, perm)
+}
@@ -0,0 +1,173 @@
+package traefik
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestClientMigrateLegacyFile(t *testing.T) {
+	root := t.TempDir()
+	dynamicDir := filepath.Join(root, "dynamic")
+	certsDir := filepath.Join(root, "certs")
+
+	legacyCerts := filepath.Join(certsDir, "api")
+	if err := os.MkdirAll(legacyCerts, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"abc.crt", "abc.key"} {
+		if err := os.WriteFile(filepath.Join(legacyCerts, name), []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := &Config{TLS: &TLSConfig{Certificates: []CertificateFiles{
+		{CertFile: filepath.Join(legacyCerts, "abc.crt"), KeyFile: filepath.Join(legacyCerts, "abc.key")},
+		{CertFile: "/other/site.crt", KeyFile: "/other/site.key"},
+	}}}
+	legacy.HTTP.Routers = map[string]Router{
+		"api":                  {Rule: "Host(`api.test`)", Service: "api-svc", Middlewares: []string{"api-auth", "gzip@docker"}},
+		"api-route-1":          {Rule: "Host(`www.api.test`)", Service: "api-svc"},
+		"api-route-1-redirect": {Rule: "Host(`www.api.test`)", Service: "api-svc", Middlewares: []string{"api-https-redirect"}},
+		"web":                  {Rule: "Host(`web.test`)", Service: "web-v1@docker"},
+		"worker":               {Rule: "Host(`worker.test`)", Service: "worker-svc"},
+		"manual":               {Rule: "Host(`manual.test`)", Service: "manual@file"},
+	}
+	legacy.HTTP.Middlewares = map[string]Middleware{
+		"api-auth":           {BasicAuth: &BasicAuth{Users: []string{"user:hash"}}},
+		"api-https-redirect": {RedirectScheme: &RedirectScheme{Scheme: "https"}},
+	}
+	legacy.HTTP.Services = map[string]ServiceBlock{
+		"api-svc":    {Weighted: &Weighted{Services: []WeightedService{{Name: "api-v1-r1@docker", Weight: 100}}}},
+		"worker-svc": {Weighted: &Weighted{Services: []WeightedService{{Name: "worker-v1@docker", Weight: 100}}}},
+	}
+
+	if err := os.MkdirAll(dynamicDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(dynamicDir, "dynamic.yml")
+	out, err := yaml.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacyPath, out, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(dynamicDir, certsDir)
+	ambiguous, err := c.MigrateLegacyFile(legacyPath, []ServiceRef{
+		{Application: "shop", Name: "api"},
+		{Application: "shop", Name: "web"},
+		{Application: "shop", Name: "worker"},
+		{Application: "jobs", Name: "worker"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"worker"}; !reflect.DeepEqual(ambiguous, want) {
+		t.Errorf("ambiguous = %v, want %v", ambiguous, want)
+	}
+
+	api, err := c.load(filepath.Join(dynamicDir, "shop-api.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRouters := map[string]Router{
+		"api":                  {Rule: "Host(`api.test`)", Service: "api-svc", Middlewares: []string{"api-auth", "gzip@docker"}},
+		"api-route-1":          {Rule: "Host(`www.api.test`)", Service: "api-svc"},
+		"api-route-1-redirect": {Rule: "Host(`www.api.test`)", Service: "api-svc", Middlewares: []string{"api-https-redirect"}},
+	}
+	if !reflect.DeepEqual(api.HTTP.Routers, wantRouters) {
+		t.Errorf("routers = %+v, want %+v", api.HTTP.Routers, wantRouters)
+	}
+	for _, name := range []string{"api-auth", "api-https-redirect"} {
+		if _, ok := api.HTTP.Middlewares[name]; !ok {
+			t.Errorf("middleware %s not migrated", name)
+		}
+	}
+	if _, ok := api.HTTP.Services["api-svc"]; !ok {
+		t.Error("weighted service api-svc not migrated")
+	}
+	if got, err := c.GetCurrentSlot("shop", "api"); err != nil || got != "v1-r1" {
+		t.Errorf("GetCurrentSlot() = %q, %v, want v1-r1", got, err)
+	}
+
+	newCerts := filepath.Join(certsDir, "shop-api")
+	wantTLS := &TLSConfig{Certificates: []CertificateFiles{
+		{CertFile: filepath.Join(newCerts, "abc.crt"), KeyFile: filepath.Join(newCerts, "abc.key")},
+	}}
+	if !reflect.DeepEqual(api.TLS, wantTLS) {
+		t.Errorf("tls = %+v, want %+v", api.TLS, wantTLS)
+	}
+	for _, files := range wantTLS.Certificates {
+		for _, name := range []string{files.CertFile, files.KeyFile} {
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("certificate file not moved: %v", err)
+			}
+		}
+	}
+	if _, err := os.Stat(legacyCerts); !os.IsNotExist(err) {
+		t.Errorf("legacy certificates directory still exists: %v", err)
+	}
+
+	web, err := c.load(filepath.Join(dynamicDir, "shop-web.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if router := web.HTTP.Routers["web"]; router.Service != "web-v1@docker" {
+		t.Errorf("router web sends to %q, want web-v1@docker", router.Service)
+	}
+
+	rest, err := c.load(legacyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for name := range rest.HTTP.Routers {
+		left = append(left, name)
+	}
+	if len(left) != 2 || rest.HTTP.Routers["worker"].Service != "worker-svc" || rest.HTTP.Routers["manual"].Service != "manual@file" {
+		t.Errorf("routers left in the shared file = %v, want manual and worker", left)
+	}
+	if _, ok := rest.HTTP.Services["worker-svc"]; !ok {
+		t.Error("weighted service of the ambiguous worker left the shared file")
+	}
+	if rest.TLS == nil || len(rest.TLS.Certificates) != 1 || rest.TLS.Certificates[0].CertFile != "/other/site.crt" {
+		t.Errorf("tls left in the shared file = %+v, want /other/site.crt only", rest.TLS)
+	}
+}
+
+func TestClientMigrateLegacyFileRemovesEmptyFile(t *testing.T) {
+	dynamicDir := t.TempDir()
+	legacyPath := filepath.Join(dynamicDir, "dynamic.yml")
+
+	legacy := &Config{}
+	legacy.HTTP.Routers = map[string]Router{"api": {Rule: "Host(`api.test`)", Service: "api-svc"}}
+	out, err := yaml.Marshal(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(legacyPath, out, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(dynamicDir, "")
+	if _, err := c.MigrateLegacyFile(legacyPath, []ServiceRef{{Application: "shop", Name: "api"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(legacyPath); !os.IsNotExist(err) {
+		t.Errorf("shared file still exists: %v", err)
+	}
+	if backups, _ := c.backups(legacyPath); len(backups) != 1 {
+		t.Errorf("shared file backups = %v, want one", backups)
+	}
+
+	// Running it again once the shared file is gone does nothing.
+	if _, err := c.MigrateLegacyFile(legacyPath, []ServiceRef{{Application: "shop", Name: "api"}}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -10,9 +10,15 @@ type Client struct {
 }
 
 func New() *Client {
+	return NewWithTimeout(5 * time.Second)
+}
+
+// NewWithTimeout creates a client whose requests give up after timeout. A zero timeout
+// leaves it to the context of each request.
+func NewWithTimeout(timeout time.Duration) *Client {
 	return &Client{
 		client: &http.Client{
-			Timeout: 5 * time.Second,
+			Timeout: timeout,
 		},
 	}
 }
@@ -20,3 +26,7 @@ func New() *Client {
 func (c *Client) Get(url string) (*http.Response, error) {
 	return c.client.Get(url)
 }
+
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req)
+}